@@ -0,0 +1,461 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件根据 Hook 的数据（blockInfo）生成每笔交易的账户读写集合，并据此估计并行加速比
+//GetGraphDemo、OutputConflictModelSpeedUp、speedup 的 gas 加速比、cluster 和 dag 都使用这里的读写集合
+//对合约自身的读写记在存储地址上，DELEGATECALL 时为代理合约（见 call_context.go）
+//--------------------------------------------------------------------------------------
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/parallel"
+)
+
+// 冲突建模的选项
+// 每笔交易都会给 coinbase 支付手续费，且会修改发送者的 nonce，如果都算作写操作，整个区块只能串行执行
+type ConflictModel struct {
+	IncludeCoinbase bool // 是否把向 coinbase（手续费接收者）支付手续费算作对 coinbase 账户的读写
+	IncludeSender   bool // 是否把发送者 nonce 的增加以及手续费的扣除算作对发送者账户的读写
+}
+
+// 报告中使用的全部建模方式
+var conflictModelList []ConflictModel = []ConflictModel{
+	{IncludeCoinbase: false, IncludeSender: false},
+	{IncludeCoinbase: false, IncludeSender: true},
+	{IncludeCoinbase: true, IncludeSender: false},
+	{IncludeCoinbase: true, IncludeSender: true},
+}
+
+// 建模方式的名称，用于报告输出
+func (m ConflictModel) String() string {
+	coinbase := "exclude"
+	if m.IncludeCoinbase {
+		coinbase = "include"
+	}
+	sender := "exclude"
+	if m.IncludeSender {
+		sender = "include"
+	}
+	return "coinbase=" + coinbase + " sender=" + sender
+}
+
+// 交易对某个账户的访问方式
+type AccountAccess struct {
+	Read     bool
+	Write    bool
+	Create   bool
+	Reverted bool //所有访问都来自回滚的调用过程或者失败的交易（见 revert.go）
+}
+
+// 一笔交易的账户读写集合
+type TxAccessSet struct {
+	TxIndex  int
+	Accounts map[string]*AccountAccess //地址(Hex)到访问方式的映射
+	Order    []string                  //地址第一次被访问的顺序，保证画图时节点编号稳定
+}
+
+// 记录一次访问，已有的记录只会被合并不会被覆盖（只要有 1 就是 1）
+func (s *TxAccessSet) add(addr string, read bool, write bool, create bool) {
+	s.addAccess(addr, read, write, create, false)
+}
+
+// 记录一次访问，reverted 表示访问来自回滚的调用过程，按 revertPolicy 转换之后再合并
+// 转换之后没有任何访问（exclude 去掉了写操作）则不记录
+func (s *TxAccessSet) addAccess(addr string, read bool, write bool, create bool, reverted bool) {
+	if reverted {
+		read, write, create = revertPolicy.apply(read, write, create)
+	}
+	if !read && !write && !create {
+		return
+	}
+	addr = common.HexToAddress(addr).Hex() //Hook 中的地址大小写不统一，统一成 checksum 格式
+	access, ok := s.Accounts[addr]
+	if !ok {
+		access = &AccountAccess{Reverted: true}
+		s.Accounts[addr] = access
+		s.Order = append(s.Order, addr)
+	}
+	access.Read = access.Read || read
+	access.Write = access.Write || write
+	access.Create = access.Create || create
+	access.Reverted = access.Reverted && reverted
+}
+
+// 记录对账户代码或者存在性的读（CALL 检查被调用者、EXTCODE*、STATICCALL 等）
+// 预编译合约没有代码和存储，这类读不算作冲突（见 precompile.go）；对预编译合约的转账和 BALANCE 读写的是余额，照常记录
+func (s *TxAccessSet) addCodeRead(addr string, reverted bool) {
+	if isPrecompileAddr(common.HexToAddress(addr)) {
+		return
+	}
+	s.addAccess(addr, true, false, false, reverted)
+}
+
+// 根据 Hook 的数据生成每笔交易的读写集合
+// coinbase 为区块的手续费接收者，model 决定是否把手续费和 nonce 的读写算进去
+func BuildAccessSets(blockInfo *parallel.BlockInfo, coinbase common.Address, model ConflictModel) []*TxAccessSet {
+	setList := make([]*TxAccessSet, 0, len(blockInfo.Tx))
+	callTrees := blockCallTrees(blockInfo) //执行区块时没有记录调用树则为 nil
+	for i, tx := range blockInfo.Tx {
+		set := &TxAccessSet{TxIndex: i, Accounts: make(map[string]*AccountAccess)}
+		from := tx.From.Hex()
+
+		//发送者 nonce 增加以及扣除手续费
+		if model.IncludeSender {
+			set.add(from, true, true, false)
+		}
+
+		//手续费转给 coinbase
+		if model.IncludeCoinbase {
+			set.add(coinbase.Hex(), true, true, false)
+		}
+
+		//调用树（见 call_context.go），执行区块时没有记录则为 nil
+		var callTree *CallFrame
+		if callTrees != nil {
+			callTree = callTrees[i]
+		}
+		//交易失败时只有手续费和 nonce 的修改保留，转账和创建合约都被回滚（见 revert.go）
+		txFailed := txReverted(callTree)
+
+		//处理创建合约的特殊情况（init code 对新合约的读写在下面按存储地址记录）
+		if newContract := txNewContract(tx); newContract != nil {
+			set.addAccess(newContract.Hex(), false, false, true, txFailed)
+		}
+
+		//只要 Transaction 的 value 不为空就会进行转账操作, 发送者和接收者的余额都会改变
+		//创建合约时同样扣除发送者的余额，新合约的余额已经算在 create 中
+		if tx.Value.Sign() > 0 {
+			set.addAccess(from, true, true, false, txFailed)
+			if to := txTo(tx); to != nil {
+				set.addAccess(to.Hex(), true, true, false, txFailed)
+			}
+		}
+
+		//每个调用过程的存储地址，DELEGATECALL 的存储属于调用者（见 call_context.go），以及调用过程是否回滚
+		contextList := storageContexts(callTree, tx)
+		revertedList := revertedFrames(callTree, tx)
+
+		//进入每个调用过程的循环，如果调用的合约有对自身的读写操作，则记录对该合约（存储地址）的读写
+		for j, contractInfo := range tx.CallQueue {
+			doRead := false
+			doWrite := false
+			reverted := revertedList[j]
+
+			for _, keyOpcode := range contractInfo.KeyOpcode {
+				split := strings.Split(keyOpcode, " ")
+				if len(split) < 3 {
+					continue
+				}
+				opcode := split[1]
+				switch opcode {
+				case "BALANCE", "SELFBALANCE":
+					set.addAccess(split[2], true, false, false, reverted)
+				case "EXTCODESIZE", "EXTCODEHASH", "EXTCODECOPY", "STATICCALL", "DELEGATECALL", "CALLCODE": //账户级读操作（见 account_read.go）
+					set.addCodeRead(split[2], reverted)
+				case "TLOAD", "TSTORE", "MCOPY", "BLOBHASH", "BLOBBASEFEE": //transient storage 只在交易内有效，其余不访问账户（见 cancun.go）
+				case "SLOAD":
+					doRead = true
+				case "SSTORE":
+					doWrite = true
+				case "CREATE", "CREATE2":
+					set.addAccess(split[2], false, false, true, reverted)
+					if len(split) > 3 && split[3] == "doTransfer_true" { //create 有转账发生
+						doRead = true
+						doWrite = true
+					}
+				case "CALL":
+					set.addCodeRead(split[2], reverted)                  //检查被调用者是否存在并加载代码
+					if len(split) > 3 && split[3] == "doTransfer_true" { //需要转账，对预编译合约的转账也会修改它的余额
+						set.addAccess(split[2], true, true, false, reverted)
+						doRead = true
+						doWrite = true
+					}
+				case "SELFDESTRUCT":
+					set.addAccess(split[2], true, true, false, reverted)
+					doRead = true
+					doWrite = true
+				}
+			}
+
+			//如果该调用合约没有涉及读或写则继续
+			if !doRead && !doWrite {
+				continue
+			}
+			set.addAccess(contextList[j].Hex(), doRead, doWrite, false, reverted)
+		}
+
+		//Hook 没有记录的账户级读操作（EXTCODE*、STATICCALL 等），只有调用树中有
+		if callTree != nil {
+			callTree.walk(func(frame *CallFrame) {
+				for _, accountRead := range frame.AccountReads {
+					if split := strings.Split(accountRead, " "); len(split) >= 3 {
+						set.addCodeRead(split[2], frame.Reverted)
+					}
+				}
+			})
+		}
+
+		setList = append(setList, set)
+	}
+	return setList
+}
+
+// 判断两笔交易的读写集合是否冲突（写后读、写后写、读后写），创建也算作写
+func isConflict(a *TxAccessSet, b *TxAccessSet) bool {
+	for addr, x := range a.Accounts {
+		y, ok := b.Accounts[addr]
+		if !ok {
+			continue
+		}
+		xWrite := x.Write || x.Create
+		yWrite := y.Write || y.Create
+		if xWrite || yWrite {
+			return true
+		}
+	}
+	return false
+}
+
+// 根据读写集合估计一个区块的并行加速比
+// 每笔交易只能在与它冲突的所有前序交易完成后才能开始，加速比 = 总权重 / 关键路径的权重
+// weights 为每笔交易的权重（例如交易消耗的 gas），数量与交易数量不一致时（Hook 的数据与收据对不上）返回 NaN
+func EstimateSpeedUp(setList []*TxAccessSet, weights []uint64) float64 {
+	if len(weights) != len(setList) {
+		return math.NaN()
+	}
+	var total uint64 = 0
+	var criticalPath uint64 = 0
+	finish := make([]uint64, len(setList)) //每笔交易最早的完成时刻
+	for j := range setList {
+		var start uint64 = 0
+		for i := 0; i < j; i++ {
+			if finish[i] > start && isConflict(setList[i], setList[j]) {
+				start = finish[i]
+			}
+		}
+		finish[j] = start + weights[j]
+		total += weights[j]
+		if finish[j] > criticalPath {
+			criticalPath = finish[j]
+		}
+	}
+	return float64(total) / float64(criticalPath) //区块中没有交易时为 NaN
+}
+
+// 把 parallel.BuildDependencyGraph 返回的关系图转换为读写集合，这样可以在同一张图上计算以 gas 为权重的加速比
+// Transfer 和 SelfDestruct 都会改变账户余额，算作读写
+func AccessSetsFromGraph(g *parallel.Graph) []*TxAccessSet {
+	setList := make([]*TxAccessSet, len(g.TxNodeList))
+	for i := range setList {
+		setList[i] = &TxAccessSet{TxIndex: i, Accounts: make(map[string]*AccountAccess)}
+	}
+	for _, edge := range g.EdgeList {
+		txID, err := strconv.Atoi(edge.From)
+		if err != nil || txID < 0 || txID >= len(setList) {
+			continue
+		}
+		op, reverted := splitRevertedLabel(edge.Op) //BuildModelDependencyGraph 生成的图中回滚的边带后缀，再按 revertPolicy 转换一次结果不变
+		switch op {
+		case "Read":
+			setList[txID].addAccess(edge.To, true, false, false, reverted)
+		case "Write":
+			setList[txID].addAccess(edge.To, false, true, false, reverted)
+		case "Create":
+			setList[txID].addAccess(edge.To, false, false, true, reverted)
+		default: //Read & Write, Transfer, SelfDestruct
+			setList[txID].addAccess(edge.To, true, true, false, reverted)
+		}
+	}
+	return setList
+}
+
+// 从交易收据中取出每笔交易消耗的 gas 作为权重
+func gasWeights(receipts types.Receipts) []uint64 {
+	weights := make([]uint64, len(receipts))
+	for i, receipt := range receipts {
+		weights[i] = receipt.GasUsed
+	}
+	return weights
+}
+
+// 根据读写集合生成关系图，只保留会导致 Transaction 并行冲突的 Account（与两个以上 Transaction 关连，且至少有一笔交易写或创建）
+// 只被读的 Account 不会导致冲突（见 isConflict），不画出来
+// 返回的图可以直接交给 GetGraphFromRelationship 绘图
+func BuildModelDependencyGraph(blockInfo *parallel.BlockInfo, coinbase common.Address, model ConflictModel) *parallel.Graph {
+	setList := BuildAccessSets(blockInfo, coinbase, model)
+
+	//统计每个 Account 与多少个 Transaction 有关连，以及是否被写
+	accountTxCnt := make(map[string]int)
+	accountWritten := make(map[string]bool)
+	accountOrder := []string{}
+	for _, set := range setList {
+		for _, addr := range set.Order {
+			if accountTxCnt[addr] == 0 {
+				accountOrder = append(accountOrder, addr)
+			}
+			accountTxCnt[addr]++
+			access := set.Accounts[addr]
+			accountWritten[addr] = accountWritten[addr] || access.Write || access.Create
+		}
+	}
+	conflicting := func(addr string) bool {
+		return accountTxCnt[addr] > 1 && accountWritten[addr]
+	}
+
+	graph := &parallel.Graph{}
+	for i, tx := range blockInfo.Tx {
+		graph.TxNodeList = append(graph.TxNodeList, parallel.TxNode{ID: i, From: tx.From.Hex(), To: tx.To, Value: tx.Value})
+	}
+	for _, addr := range accountOrder {
+		if conflicting(addr) {
+			graph.AccountNodeList = append(graph.AccountNodeList, parallel.AccountNode{Address: addr})
+		}
+	}
+	for _, set := range setList {
+		for _, addr := range set.Order {
+			if conflicting(addr) {
+				access := set.Accounts[addr]
+				graph.EdgeList = append(graph.EdgeList, parallel.Edge{From: strconv.Itoa(set.TxIndex), To: addr, Op: revertedLabel(accessLabel(access), access.Reverted)})
+			}
+		}
+	}
+	return graph
+}
+
+// 访问方式对应的箭头标签（与 colorMap 中的名称一致）
+func accessLabel(access *AccountAccess) string {
+	if access.Create { //要先判断 create 不然会覆盖掉
+		return "Create"
+	} else if access.Read && access.Write {
+		return "Read & Write"
+	} else if access.Write {
+		return "Write"
+	}
+	return "Read"
+}
+
+// OutputConflictModelSpeedUp 的累计结果，保存在检查点中
+type conflictSpeedUpAggregates struct {
+	SpeedupSum    []float64       //每种建模方式的加速比之和
+	LegalBlockCnt []int           //每种建模方式下能计算加速比的 Block 数量
+	ExcludedList  []excludedBlock //无法计算加速比的区块及其原因（与 OutputAverageSpeedUp 相同）
+}
+
+// 输出100个块在不同冲突建模方式下的平均并行加速比
+// 加速比以交易消耗的 gas 作为权重计算，是否把 coinbase 手续费和发送者 nonce 算作冲突见 ConflictModel
+// 执行失败或者无法计算加速比的区块也输出一行，并连同原因一起列在文件最后
+// checkpoint 为 nil 时不保存检查点
+func OutputConflictModelSpeedUp(blockList []uint64, checkpoint *Checkpoint) {
+	writeFile, err := openOutputFile("./output/ConflictModelSpeedUp.txt", checkpoint.Resumed())
+	if err != nil {
+		logger.Error("open output file fail", "err", err)
+		return
+	}
+	defer writeFile.Close()
+
+	//累计结果，从检查点继续执行时先恢复
+	modelCnt := len(conflictModelList)
+	aggregates := conflictSpeedUpAggregates{
+		SpeedupSum:    make([]float64, modelCnt),
+		LegalBlockCnt: make([]int, modelCnt),
+	}
+	if err := checkpoint.LoadAggregates(&aggregates); err != nil {
+		logger.Error("load checkpoint aggregates fail", "err", err)
+		return
+	}
+
+	progress := NewProgress(len(checkpoint.Remaining(blockList)))
+	for i := 0; i < len(blockList); i++ {
+		blockNumber := blockList[i]
+		if checkpoint.Done(blockNumber) { //检查点中已经完成
+			continue
+		}
+
+		fmt.Fprint(writeFile, "[ Block ", i, " ]  Block number: ", blockNumber)
+		block, receipts, err := DoProcess(blockNumber)
+		if err != nil {
+			excluded := excludedBlock{BlockNumber: blockNumber, Reason: errorReason(err), Detail: err.Error()}
+			aggregates.ExcludedList = append(aggregates.ExcludedList, excluded)
+			fmt.Fprint(writeFile, "  (NaN: ", excluded.Reason, ")\n")
+			if err := checkpoint.Save(blockNumber, &aggregates); err != nil {
+				logger.Warn("save checkpoint fail", "block", blockNumber, "err", err)
+			}
+			progress.Add(0, true)
+			continue
+		}
+		weights := gasWeights(receipts)
+		blockInfo := parallel.GetBlockInfo()
+
+		for m, model := range conflictModelList {
+			setList := BuildAccessSets(blockInfo, block.Coinbase(), model)
+			speedup := EstimateSpeedUp(setList, weights)
+			if !math.IsNaN(speedup) {
+				aggregates.LegalBlockCnt[m]++
+				aggregates.SpeedupSum[m] += speedup
+			}
+			fmt.Fprint(writeFile, "  [", model, "] speedup: ", speedup)
+		}
+
+		//说明加速比为 NaN 的原因，各种建模方式的原因相同
+		if len(receipts) == 0 || len(blockInfo.Tx) != len(receipts) {
+			excluded := excludedBlock{BlockNumber: blockNumber, Reason: reasonNoTx, Detail: "empty block"}
+			if len(receipts) > 0 {
+				excluded.Reason = reasonHookMismatch
+				excluded.Detail = fmt.Sprint(len(blockInfo.Tx), " hook transactions but ", len(receipts), " receipts")
+			}
+			aggregates.ExcludedList = append(aggregates.ExcludedList, excluded)
+			fmt.Fprint(writeFile, "  (NaN: ", excluded.Reason, ")")
+		}
+		fmt.Fprint(writeFile, "\n")
+
+		if err := checkpoint.Save(blockNumber, &aggregates); err != nil {
+			logger.Warn("save checkpoint fail", "block", blockNumber, "err", err)
+		}
+		progress.Add(block.GasUsed(), false)
+	}
+
+	for m, model := range conflictModelList {
+		if aggregates.LegalBlockCnt[m] == 0 {
+			fmt.Fprintln(writeFile, "Model:", model, " Legal Block Count: 0  Average Speedup: n/a")
+			continue
+		}
+		fmt.Fprintln(writeFile, "Model:", model, " Legal Block Count:", aggregates.LegalBlockCnt[m], " Average Speedup:", aggregates.SpeedupSum[m]/float64(aggregates.LegalBlockCnt[m]))
+	}
+
+	fmt.Fprintln(writeFile, "Excluded Block Count:", len(aggregates.ExcludedList))
+	for _, excluded := range aggregates.ExcludedList {
+		fmt.Fprintln(writeFile, "Excluded Block:", excluded.BlockNumber, " Reason:", excluded.Reason, " Detail:", excluded.Detail)
+	}
+}
+
+// conflict-speedup 子命令：输出不同冲突建模方式下的平均并行加速比到 ./output/ConflictModelSpeedUp.txt
+func ConflictSpeedUpCommand(args []string) {
+	flagSet := flag.NewFlagSet("conflict-speedup", flag.ExitOnError)
+	blockSpec := flagSet.String("blocks", "block_range.csv", "block set, see block_set.go")
+	openCheckpoint := checkpointFlags(flagSet, "conflict-speedup")
+	progressFlags(flagSet)
+	validateFlags(flagSet)
+	callContextFlags(flagSet)
+	chainFlags(flagSet)
+	logFlags(flagSet)
+	flagSet.Parse(args)
+
+	blockList, err := loadBlockSet(*blockSpec)
+	if err != nil {
+		logger.Error("parse block set fail", "err", err)
+		return
+	}
+	checkpoint, err := openCheckpoint()
+	if err != nil {
+		logger.Error("open checkpoint fail", "err", err)
+		return
+	}
+	OutputConflictModelSpeedUp(blockList, checkpoint)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/parallel"
+)
+
+// 用 "r"、"w"、"c"、"rw" 表示访问方式构造读写集合
+func testAccessSet(index int, accessMap map[string]string) *TxAccessSet {
+	set := &TxAccessSet{TxIndex: index, Accounts: make(map[string]*AccountAccess)}
+	for addr, access := range accessMap {
+		set.add(addr, access == "r" || access == "rw", access == "w" || access == "rw", access == "c")
+	}
+	return set
+}
+
+func TestIsConflict(t *testing.T) {
+	const a, b = "0x000000000000000000000000000000000000aaaa", "0x000000000000000000000000000000000000bbbb"
+	testList := []struct {
+		name string
+		x    map[string]string
+		y    map[string]string
+		want bool
+	}{
+		{"read after read", map[string]string{a: "r"}, map[string]string{a: "r"}, false},
+		{"read after write", map[string]string{a: "w"}, map[string]string{a: "r"}, true},
+		{"write after read", map[string]string{a: "r"}, map[string]string{a: "w"}, true},
+		{"write after write", map[string]string{a: "w"}, map[string]string{a: "w"}, true},
+		{"create counts as write", map[string]string{a: "c"}, map[string]string{a: "r"}, true},
+		{"different accounts", map[string]string{a: "w"}, map[string]string{b: "w"}, false},
+		{"empty", map[string]string{}, map[string]string{a: "w"}, false},
+	}
+	for _, test := range testList {
+		if got := isConflict(testAccessSet(0, test.x), testAccessSet(1, test.y)); got != test.want {
+			t.Errorf("%s: isConflict = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestEstimateSpeedUp(t *testing.T) {
+	const a, b = "0x000000000000000000000000000000000000aaaa", "0x000000000000000000000000000000000000bbbb"
+	testList := []struct {
+		name    string
+		access  []map[string]string
+		weights []uint64
+		want    float64
+	}{
+		{"independent", []map[string]string{{a: "w"}, {b: "w"}}, []uint64{10, 10}, 2},
+		{"chain", []map[string]string{{a: "w"}, {a: "rw"}, {a: "r"}}, []uint64{10, 20, 30}, 1},
+		{"shared reads", []map[string]string{{a: "r"}, {a: "r"}, {a: "r"}}, []uint64{10, 10, 10}, 3},
+		{"critical path", []map[string]string{{a: "w"}, {b: "w"}, {a: "r"}}, []uint64{10, 40, 20}, 70.0 / 40},
+		{"diamond", []map[string]string{{a: "w", b: "w"}, {a: "r"}, {b: "r"}}, []uint64{10, 10, 10}, 30.0 / 20},
+	}
+	for _, test := range testList {
+		setList := make([]*TxAccessSet, len(test.access))
+		for i, access := range test.access {
+			setList[i] = testAccessSet(i, access)
+		}
+		if got := EstimateSpeedUp(setList, test.weights); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("%s: EstimateSpeedUp = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestEstimateSpeedUpNaN(t *testing.T) {
+	set := testAccessSet(0, map[string]string{"0x000000000000000000000000000000000000aaaa": "w"})
+	if got := EstimateSpeedUp(nil, nil); !math.IsNaN(got) {
+		t.Errorf("empty block: EstimateSpeedUp = %v, want NaN", got)
+	}
+	if got := EstimateSpeedUp([]*TxAccessSet{set}, []uint64{1, 2}); !math.IsNaN(got) {
+		t.Errorf("weights mismatch: EstimateSpeedUp = %v, want NaN", got)
+	}
+	if got := EstimateSpeedUp([]*TxAccessSet{set, set}, []uint64{1}); !math.IsNaN(got) {
+		t.Errorf("weights mismatch: EstimateSpeedUp = %v, want NaN", got)
+	}
+}
+
+func TestBuildAccessSetsConflictModel(t *testing.T) {
+	sender := common.HexToAddress("0x0000000000000000000000000000000000001111")
+	coinbase := common.HexToAddress("0x0000000000000000000000000000000000002222")
+	blockInfo := &parallel.BlockInfo{Tx: []*parallel.TxInfo{
+		{From: sender, To: "0x0000000000000000000000000000000000003333", Value: big.NewInt(0)},
+	}}
+	testList := []struct {
+		model        ConflictModel
+		wantSender   bool
+		wantCoinbase bool
+	}{
+		{ConflictModel{}, false, false},
+		{ConflictModel{IncludeSender: true}, true, false},
+		{ConflictModel{IncludeCoinbase: true}, false, true},
+		{ConflictModel{IncludeCoinbase: true, IncludeSender: true}, true, true},
+	}
+	for _, test := range testList {
+		set := BuildAccessSets(blockInfo, coinbase, test.model)[0]
+		if _, ok := set.Accounts[sender.Hex()]; ok != test.wantSender {
+			t.Errorf("%v: sender recorded = %v, want %v", test.model, ok, test.wantSender)
+		}
+		if _, ok := set.Accounts[coinbase.Hex()]; ok != test.wantCoinbase {
+			t.Errorf("%v: coinbase recorded = %v, want %v", test.model, ok, test.wantCoinbase)
+		}
+	}
+}
+
+func TestBuildAccessSetsValueTransfer(t *testing.T) {
+	sender := common.HexToAddress("0x0000000000000000000000000000000000001111")
+	to := common.HexToAddress("0x0000000000000000000000000000000000003333")
+	newContract := common.HexToAddress("0x0000000000000000000000000000000000004444")
+	blockInfo := &parallel.BlockInfo{Tx: []*parallel.TxInfo{
+		{From: sender, To: to.Hex(), Value: big.NewInt(1)},
+		{From: sender, To: "nil", NewContractAddr: newContract, Value: big.NewInt(1)},
+		{From: sender, To: "nil", NewContractAddr: newContract, Value: big.NewInt(0)},
+	}}
+	wantList := []map[string]AccountAccess{
+		{sender.Hex(): {Read: true, Write: true}, to.Hex(): {Read: true, Write: true}},
+		{sender.Hex(): {Read: true, Write: true}, newContract.Hex(): {Create: true}},
+		{newContract.Hex(): {Create: true}},
+	}
+	setList := BuildAccessSets(blockInfo, common.Address{}, ConflictModel{})
+	for i, want := range wantList {
+		got := map[string]AccountAccess{}
+		for addr, access := range setList[i].Accounts {
+			got[addr] = *access
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("tx %d: accounts = %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+func TestBuildModelDependencyGraph(t *testing.T) {
+	token := common.HexToAddress("0x000000000000000000000000000000000000aaaa")
+	oracle := common.HexToAddress("0x000000000000000000000000000000000000bbbb")
+	call := func(from string, keyOpcode ...string) *parallel.TxInfo {
+		return &parallel.TxInfo{From: common.HexToAddress(from), To: token.Hex(), Value: big.NewInt(0), CallQueue: []*parallel.CallInfo{
+			{Layer: 1, ContractAddr: token, KeyOpcode: keyOpcode},
+		}}
+	}
+	//三笔交易都读 oracle 的余额，只有后两笔写 token
+	blockInfo := &parallel.BlockInfo{Tx: []*parallel.TxInfo{
+		call("0x01", "[Read] BALANCE "+oracle.Hex()),
+		call("0x02", "[Read] BALANCE "+oracle.Hex(), "[Write] SSTORE 0x01 0x02"),
+		call("0x03", "[Read] BALANCE "+oracle.Hex(), "[Write] SSTORE 0x01 0x03"),
+	}}
+	graph := BuildModelDependencyGraph(blockInfo, common.Address{}, ConflictModel{})
+	if want := []parallel.AccountNode{{Address: token.Hex()}}; !reflect.DeepEqual(graph.AccountNodeList, want) {
+		t.Errorf("account nodes = %v, want %v", graph.AccountNodeList, want)
+	}
+	for _, edge := range graph.EdgeList {
+		if edge.To != token.Hex() {
+			t.Errorf("edge to read-only account: %+v", edge)
+		}
+	}
+	if len(graph.EdgeList) != 2 {
+		t.Errorf("edges = %+v, want the two writers of the token", graph.EdgeList)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件记录 Hook 没有记录的账户级读操作：EXTCODESIZE、EXTCODEHASH、EXTCODECOPY 读取其他账户的代码，
+//STATICCALL、DELEGATECALL、CALLCODE 加载被调用者的代码（CALL 的存在性检查由 Hook 的 CALL 记录，见 BuildAccessSets）
+//前面的交易创建合约或者自毁会改变这些结果，不记录的话依赖分析是乐观的
+//由 EVMLogger 的 CaptureState 记录在所在的调用过程中（CallFrame.AccountReads），格式与 Hook 的 KeyOpcode 相同，例如:
+//	[Read] EXTCODESIZE 0x...
+//导出 Hook 数据（txLog.json）时合并到对应 CallQueue 项的 KeyOpcode 中
+//--------------------------------------------------------------------------------------
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/parallel"
+)
+
+// 读取的账户地址在栈中的位置（从栈顶开始）
+var accountReadOps map[vm.OpCode]int = map[vm.OpCode]int{
+	vm.EXTCODESIZE:  0,
+	vm.EXTCODEHASH:  0,
+	vm.EXTCODECOPY:  0,
+	vm.STATICCALL:   1,
+	vm.DELEGATECALL: 1,
+	vm.CALLCODE:     1,
+}
+
+// 在当前的调用过程中记录账户级读操作，在 CaptureState 中调用
+func (r *callFrameRecorder) recordAccountRead(op vm.OpCode, scope *vm.ScopeContext) {
+	pos, ok := accountReadOps[op]
+	if !ok || len(r.frameStack) == 0 || scope == nil || len(scope.Stack.Data()) <= pos {
+		return
+	}
+	addr := common.Address(scope.Stack.Back(pos).Bytes20())
+	if isPrecompileAddr(addr) { //预编译合约没有代码
+		return
+	}
+	frame := r.frameStack[len(r.frameStack)-1]
+	frame.AccountReads = append(frame.AccountReads, "[Read] "+op.String()+" "+addr.Hex())
+}
+
+// 导出时每个 CallQueue 项的 KeyOpcode：Hook 记录的 KeyOpcode 加上对应调用过程的账户级读操作
+// 同一个调用过程对应多个 CallQueue 项时，账户级读操作只合并到第一个
+func exportCallQueue(tree *CallFrame, callQueue []*parallel.CallInfo) []*parallel.CallInfo {
+	if tree == nil {
+		return callQueue
+	}
+	exported := make([]*parallel.CallInfo, len(callQueue))
+	merged := make(map[*CallFrame]bool)
+	for i, frame := range matchCallQueue(tree, callQueue) {
+		call := *callQueue[i]
+		if frame != nil && !merged[frame] && len(frame.AccountReads) > 0 {
+			call.KeyOpcode = append(append([]string{}, call.KeyOpcode...), frame.AccountReads...)
+			merged[frame] = true
+		}
+		exported[i] = &call
+	}
+	return exported
+}
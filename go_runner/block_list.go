@@ -0,0 +1,49 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件读取区块列表文件（例如 block_range.csv），第一列为区块号，其余列为 select-blocks 写入的元数据
+//第一行如果不是数字则当作表头跳过，空行也会被跳过
+//--------------------------------------------------------------------------------------
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 读取区块列表文件，返回区块号列表
+func ReadBlockList(path string) ([]uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	csvReader := csv.NewReader(file)
+	csvReader.FieldsPerRecord = -1 //允许每行的列数不同
+	blockList := []uint64{}
+	for line := 1; ; line++ {
+		rec, err := csvReader.Read()
+		if err == io.EOF { //要先判断 EOF，EOF 时 rec 为 nil
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rec) == 0 || strings.TrimSpace(rec[0]) == "" {
+			continue
+		}
+		blockNumber, err := strconv.ParseUint(strings.TrimSpace(rec[0]), 10, 64)
+		if err != nil {
+			if line == 1 { //表头
+				continue
+			}
+			return nil, fmt.Errorf("%s line %d: %v", path, line, err)
+		}
+		blockList = append(blockList, blockNumber)
+	}
+	return blockList, nil
+}
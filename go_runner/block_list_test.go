@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// 把内容写入临时文件，返回文件路径
+func writeTestFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadBlockList(t *testing.T) {
+	testList := []struct {
+		name    string
+		content string
+		want    []uint64
+	}{
+		{"plain", "9833300\n9833301\n", []uint64{9833300, 9833301}},
+		{"header", "block_number,hash,gas_used\n9833300,0xab,100\n9833301,0xcd,200\n", []uint64{9833300, 9833301}},
+		{"no header keeps first block", "9833300,0xab\n9833301,0xcd\n", []uint64{9833300, 9833301}},
+		{"blank lines", "block_number\n\n9833300\n\n\n9833301\n", []uint64{9833300, 9833301}},
+		{"empty first column", "9833300\n,0xab\n9833301\n", []uint64{9833300, 9833301}},
+		{"spaces and CRLF", " 9833300 \r\n9833301\r\n", []uint64{9833300, 9833301}},
+		{"header only", "block_number\n", []uint64{}},
+	}
+	for _, test := range testList {
+		got, err := ReadBlockList(writeTestFile(t, "blocks.csv", test.content))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: ReadBlockList = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestReadBlockListInvalid(t *testing.T) {
+	if _, err := ReadBlockList(writeTestFile(t, "blocks.csv", "9833300\nabc\n")); err == nil {
+		t.Error("a non-numeric line after the first should fail")
+	}
+	if _, err := ReadBlockList(filepath.Join(t.TempDir(), "missing.csv")); err == nil {
+		t.Error("a missing file should fail")
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件定义 go_runner（geth）和 rust_runner（reth）共用的区块执行结果格式，并提供 compare 子命令比较两边的结果
+//结果为 CSV，第一行为表头: block_number,gas_used,tx_count,exec_time_ns,state_root,receipts_root
+//	go run . replay -blocks block_range.csv -results ./output/go_result.csv
+//	cd ../rust_runner && cargo run --release            （输出 rust_result.csv）
+//	go run . compare -go ./output/go_result.csv -rust ../rust_runner/rust_result.csv
+//state_root 和 receipts_root 为空表示该端没有计算，此时该字段不比较，输出到 not_compared 列，不算作不一致
+//rust_runner 计算 receipts root；reth 的历史状态（history_by_block_number）不能计算 state root，所以 state_root 为空
+//--------------------------------------------------------------------------------------
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 一个区块的执行结果
+type BlockResult struct {
+	BlockNumber  uint64
+	GasUsed      uint64
+	TxCount      int
+	ExecTime     time.Duration //执行区块中交易的时间，不包括读取区块和状态
+	StateRoot    string
+	ReceiptsRoot string
+}
+
+// CSV 的表头
+var blockResultCSVHeader []string = []string{"block_number", "gas_used", "tx_count", "exec_time_ns", "state_root", "receipts_root"}
+
+// 转换为 CSV 的一行
+func (r BlockResult) toCSV() []string {
+	return []string{
+		strconv.FormatUint(r.BlockNumber, 10),
+		strconv.FormatUint(r.GasUsed, 10),
+		strconv.Itoa(r.TxCount),
+		strconv.FormatInt(r.ExecTime.Nanoseconds(), 10),
+		r.StateRoot,
+		r.ReceiptsRoot,
+	}
+}
+
+// 读取结果文件，按表头的列名读取，缺少的列保持为零值
+func ReadBlockResults(path string) ([]BlockResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	csvReader := csv.NewReader(file)
+	csvReader.FieldsPerRecord = -1
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	column := make(map[string]int)
+	for i, name := range header {
+		column[strings.TrimSpace(name)] = i
+	}
+	if _, ok := column["block_number"]; !ok {
+		return nil, fmt.Errorf("%s: missing block_number column", path)
+	}
+	field := func(record []string, name string) string {
+		if i, ok := column[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	resultList := []BlockResult{}
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		result := BlockResult{StateRoot: field(record, "state_root"), ReceiptsRoot: field(record, "receipts_root")}
+		if result.BlockNumber, err = strconv.ParseUint(field(record, "block_number"), 10, 64); err != nil {
+			return nil, fmt.Errorf("%s: invalid block number: %v", path, record)
+		}
+		result.GasUsed, _ = strconv.ParseUint(field(record, "gas_used"), 10, 64)
+		result.TxCount, _ = strconv.Atoi(field(record, "tx_count"))
+		execTime, _ := strconv.ParseInt(field(record, "exec_time_ns"), 10, 64)
+		result.ExecTime = time.Duration(execTime)
+		resultList = append(resultList, result)
+	}
+	return resultList, nil
+}
+
+// 两边的结果不一致的字段
+func resultDivergence(goResult BlockResult, rustResult BlockResult) []string {
+	divergence := []string{}
+	if goResult.GasUsed != rustResult.GasUsed {
+		divergence = append(divergence, "gas_used")
+	}
+	if goResult.TxCount != rustResult.TxCount {
+		divergence = append(divergence, "tx_count")
+	}
+	if goResult.StateRoot != "" && rustResult.StateRoot != "" && !strings.EqualFold(goResult.StateRoot, rustResult.StateRoot) {
+		divergence = append(divergence, "state_root")
+	}
+	if goResult.ReceiptsRoot != "" && rustResult.ReceiptsRoot != "" && !strings.EqualFold(goResult.ReceiptsRoot, rustResult.ReceiptsRoot) {
+		divergence = append(divergence, "receipts_root")
+	}
+	return divergence
+}
+
+// 有一边没有计算、因此没有比较的字段
+func resultNotCompared(goResult BlockResult, rustResult BlockResult) []string {
+	notCompared := []string{}
+	if goResult.StateRoot == "" || rustResult.StateRoot == "" {
+		notCompared = append(notCompared, "state_root")
+	}
+	if goResult.ReceiptsRoot == "" || rustResult.ReceiptsRoot == "" {
+		notCompared = append(notCompared, "receipts_root")
+	}
+	return notCompared
+}
+
+// CSV 的表头
+var compareCSVHeader []string = []string{"block_number", "go_exec_time_ns", "rust_exec_time_ns", "time_ratio", "go_gas_used", "rust_gas_used", "divergence", "not_compared"}
+
+// compare 子命令：按区块比较 go_runner 和 rust_runner 的结果，输出每个区块的时间比（go / rust）和不一致的字段
+func CompareCommand(args []string) {
+	flagSet := flag.NewFlagSet("compare", flag.ExitOnError)
+	goPath := flagSet.String("go", "./output/go_result.csv", "go_runner results")
+	rustPath := flagSet.String("rust", "../rust_runner/rust_result.csv", "rust_runner results")
+	outFile := flagSet.String("out", "./output/Compare.csv", "output CSV file")
+	logFlags(flagSet)
+	flagSet.Parse(args)
+
+	goList, err := ReadBlockResults(*goPath)
+	if err != nil {
+		logger.Error("read go results fail", "err", err)
+		return
+	}
+	rustList, err := ReadBlockResults(*rustPath)
+	if err != nil {
+		logger.Error("read rust results fail", "err", err)
+		return
+	}
+	rustMap := make(map[uint64]BlockResult)
+	for _, result := range rustList {
+		rustMap[result.BlockNumber] = result
+	}
+
+	writeFile, err := os.Create(*outFile)
+	if err != nil {
+		logger.Error("create output file fail", "err", err)
+		return
+	}
+	defer writeFile.Close()
+	csvWriter := csv.NewWriter(writeFile)
+	defer csvWriter.Flush()
+	csvWriter.Write(compareCSVHeader)
+
+	ratioList := []float64{}
+	divergentCnt, goOnlyCnt := 0, 0
+	notComparedCnt := make(map[string]int) //每个字段没有比较的区块数
+	matched := make(map[uint64]bool)
+	for _, goResult := range goList {
+		rustResult, ok := rustMap[goResult.BlockNumber]
+		if !ok {
+			goOnlyCnt++
+			continue
+		}
+		matched[goResult.BlockNumber] = true
+
+		ratio := ""
+		if rustResult.ExecTime > 0 {
+			value := float64(goResult.ExecTime) / float64(rustResult.ExecTime)
+			ratioList = append(ratioList, value)
+			ratio = strconv.FormatFloat(value, 'f', 4, 64)
+		}
+		divergence := resultDivergence(goResult, rustResult)
+		notCompared := resultNotCompared(goResult, rustResult)
+		for _, field := range notCompared {
+			notComparedCnt[field]++
+		}
+		if len(divergence) > 0 {
+			divergentCnt++
+			logger.Warn("results diverge", "block", goResult.BlockNumber, "fields", strings.Join(divergence, ";"))
+		}
+		csvWriter.Write([]string{
+			strconv.FormatUint(goResult.BlockNumber, 10),
+			strconv.FormatInt(goResult.ExecTime.Nanoseconds(), 10),
+			strconv.FormatInt(rustResult.ExecTime.Nanoseconds(), 10),
+			ratio,
+			strconv.FormatUint(goResult.GasUsed, 10),
+			strconv.FormatUint(rustResult.GasUsed, 10),
+			strings.Join(divergence, ";"),
+			strings.Join(notCompared, ";"),
+		})
+	}
+
+	fmt.Println("Compared Block Count:", len(matched))
+	fmt.Println("Go Only Block Count:", goOnlyCnt)
+	fmt.Println("Rust Only Block Count:", len(rustMap)-len(matched))
+	fmt.Println("Divergent Block Count:", divergentCnt)
+	fmt.Println("State Root Not Compared Block Count:", notComparedCnt["state_root"])
+	fmt.Println("Receipts Root Not Compared Block Count:", notComparedCnt["receipts_root"])
+	fmt.Println("Time Ratio (go / rust) Stats:", summarize(ratioList))
+	logger.Info("output file", "path", *outFile)
+}
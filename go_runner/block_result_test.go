@@ -0,0 +1,67 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadBlockResults(t *testing.T) {
+	goResult := BlockResult{BlockNumber: 9833300, GasUsed: 9990000, TxCount: 120, ExecTime: 35 * time.Millisecond, StateRoot: "0xaa", ReceiptsRoot: "0xbb"}
+	content := "block_number,gas_used,tx_count,exec_time_ns,state_root,receipts_root\n"
+	for _, field := range goResult.toCSV() {
+		content += field + ","
+	}
+	content = content[:len(content)-1] + "\n\n" //空行跳过
+	got, err := ReadBlockResults(writeTestFile(t, "go_result.csv", content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []BlockResult{goResult}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadBlockResults = %+v, want %+v", got, want)
+	}
+
+	//列的顺序不同，缺少的列保持为零值
+	content = "receipts_root, block_number ,exec_time_ns\n0xbb,9833300,1000\n"
+	got, err = ReadBlockResults(writeTestFile(t, "rust_result.csv", content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BlockResult{{BlockNumber: 9833300, ExecTime: 1000, ReceiptsRoot: "0xbb"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadBlockResults = %+v, want %+v", got, want)
+	}
+}
+
+func TestReadBlockResultsInvalid(t *testing.T) {
+	for _, content := range []string{"", "gas_used,tx_count\n100,1\n", "block_number\nabc\n"} {
+		if got, err := ReadBlockResults(writeTestFile(t, "result.csv", content)); err == nil {
+			t.Errorf("%q: ReadBlockResults = %+v, want error", content, got)
+		}
+	}
+}
+
+func TestResultDivergence(t *testing.T) {
+	base := BlockResult{BlockNumber: 1, GasUsed: 100, TxCount: 2, StateRoot: "0xAA", ReceiptsRoot: "0xbb"}
+	testList := []struct {
+		name            string
+		rust            BlockResult
+		wantDivergence  []string
+		wantNotCompared []string
+	}{
+		{"same", BlockResult{BlockNumber: 1, GasUsed: 100, TxCount: 2, StateRoot: "0xaa", ReceiptsRoot: "0xBB"}, []string{}, []string{}},
+		{"gas and tx count", BlockResult{BlockNumber: 1, GasUsed: 101, TxCount: 3, StateRoot: "0xaa", ReceiptsRoot: "0xbb"}, []string{"gas_used", "tx_count"}, []string{}},
+		{"roots", BlockResult{BlockNumber: 1, GasUsed: 100, TxCount: 2, StateRoot: "0xab", ReceiptsRoot: "0xbc"}, []string{"state_root", "receipts_root"}, []string{}},
+		{"rust without state root", BlockResult{BlockNumber: 1, GasUsed: 100, TxCount: 2, ReceiptsRoot: "0xbb"}, []string{}, []string{"state_root"}},
+		{"rust without roots", BlockResult{BlockNumber: 1, GasUsed: 100, TxCount: 2}, []string{}, []string{"state_root", "receipts_root"}},
+		{"receipts diverge without state root", BlockResult{BlockNumber: 1, GasUsed: 100, TxCount: 2, ReceiptsRoot: "0xbc"}, []string{"receipts_root"}, []string{"state_root"}},
+	}
+	for _, test := range testList {
+		if got := resultDivergence(base, test.rust); !reflect.DeepEqual(got, test.wantDivergence) {
+			t.Errorf("%s: resultDivergence = %v, want %v", test.name, got, test.wantDivergence)
+		}
+		if got := resultNotCompared(base, test.rust); !reflect.DeepEqual(got, test.wantNotCompared) {
+			t.Errorf("%s: resultNotCompared = %v, want %v", test.name, got, test.wantNotCompared)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件解析区块集合的表达式，所有子命令都用 -blocks 参数以同样的方式指定要执行的区块
+//支持的写法（多个写法用逗号隔开，结果去重并保持顺序）:
+//	9833300                单个区块
+//	9800000-9800999        闭区间
+//	9800000:10000:100      start:count:step，从 start 开始每隔 step 取一个，共 count 个（step 默认为 1）
+//	latest-N               数据库中最新的 N 个区块（latest 表示最新的区块）
+//	0x...                  区块 Hash
+//	block_range.csv        文件，支持 CSV（第一列为区块号）、JSON（数组）和每行一个区块号的文本
+//--------------------------------------------------------------------------------------
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// 一个区间表达式最多包含的区块数，超过主网的区块高度，避免写错的表达式（例如 9800000:18446744073709551615）耗尽内存
+const maxBlockRangeCount = 50_000_000
+
+// 解析区块集合的表达式，db 用于解析 latest 和区块 Hash，可以为 nil（此时不支持这两种写法）
+func ParseBlockSet(spec string, db ethdb.Database) ([]uint64, error) {
+	blockList := []uint64{}
+	seen := make(map[uint64]bool)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		itemList, err := parseBlockItem(item, db)
+		if err != nil {
+			return nil, err
+		}
+		for _, number := range itemList {
+			if !seen[number] {
+				seen[number] = true
+				blockList = append(blockList, number)
+			}
+		}
+	}
+	if len(blockList) == 0 {
+		return nil, fmt.Errorf("empty block set: %q", spec)
+	}
+	return blockList, nil
+}
+
+// 解析一项表达式
+func parseBlockItem(item string, db ethdb.Database) ([]uint64, error) {
+	//文件
+	if info, err := os.Stat(item); err == nil && !info.IsDir() {
+		if strings.HasSuffix(strings.ToLower(item), ".json") {
+			return readBlockJSON(item, db)
+		}
+		return ReadBlockList(item) //CSV 和每行一个区块号的文本
+	}
+
+	//最新的 N 个区块
+	if item == "latest" || strings.HasPrefix(item, "latest-") {
+		if db == nil {
+			return nil, fmt.Errorf("%s: database is required", item)
+		}
+		headNumber := rawdb.ReadHeaderNumber(db, rawdb.ReadHeadHeaderHash(db))
+		if headNumber == nil {
+			return nil, fmt.Errorf("%s: head block not found", item)
+		}
+		var n uint64 = 1
+		if item != "latest" {
+			count, err := strconv.ParseUint(strings.TrimPrefix(item, "latest-"), 10, 64)
+			if err != nil || count == 0 {
+				return nil, fmt.Errorf("invalid block expression: %s", item)
+			}
+			n = count
+		}
+		if n > *headNumber+1 {
+			n = *headNumber + 1
+		}
+		return blockRange(*headNumber-n+1, n, 1)
+	}
+
+	//区块 Hash
+	if strings.HasPrefix(item, "0x") && len(item) == 66 {
+		if db == nil {
+			return nil, fmt.Errorf("%s: database is required", item)
+		}
+		number := rawdb.ReadHeaderNumber(db, common.HexToHash(item))
+		if number == nil {
+			return nil, fmt.Errorf("block hash not found: %s", item)
+		}
+		return []uint64{*number}, nil
+	}
+
+	//start:count:step
+	if strings.Contains(item, ":") {
+		split := strings.Split(item, ":")
+		if len(split) != 2 && len(split) != 3 {
+			return nil, fmt.Errorf("invalid block expression: %s", item)
+		}
+		start, err1 := strconv.ParseUint(split[0], 10, 64)
+		count, err2 := strconv.ParseUint(split[1], 10, 64)
+		var step uint64 = 1
+		var err3 error
+		if len(split) == 3 {
+			step, err3 = strconv.ParseUint(split[2], 10, 64)
+		}
+		if err1 != nil || err2 != nil || err3 != nil || step == 0 {
+			return nil, fmt.Errorf("invalid block expression: %s", item)
+		}
+		blockList, err := blockRange(start, count, step)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block expression: %s: %v", item, err)
+		}
+		return blockList, nil
+	}
+
+	//闭区间
+	if strings.Contains(item, "-") {
+		split := strings.SplitN(item, "-", 2)
+		start, err1 := strconv.ParseUint(split[0], 10, 64)
+		end, err2 := strconv.ParseUint(split[1], 10, 64)
+		if err1 != nil || err2 != nil || end < start {
+			return nil, fmt.Errorf("invalid block expression: %s", item)
+		}
+		if end-start >= maxBlockRangeCount { //end-start+1 可能溢出
+			return nil, fmt.Errorf("invalid block expression: %s: more than %d blocks", item, maxBlockRangeCount)
+		}
+		return blockRange(start, end-start+1, 1)
+	}
+
+	//单个区块
+	number, err := strconv.ParseUint(item, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block expression or missing file: %s", item)
+	}
+	return []uint64{number}, nil
+}
+
+// 从 start 开始每隔 step 取一个区块，共 count 个
+// count 超过 maxBlockRangeCount 或者最后一个区块号超出 uint64 时返回错误
+func blockRange(start uint64, count uint64, step uint64) ([]uint64, error) {
+	if count == 0 {
+		return nil, fmt.Errorf("empty block range")
+	}
+	if count > maxBlockRangeCount {
+		return nil, fmt.Errorf("more than %d blocks", maxBlockRangeCount)
+	}
+	if step == 0 {
+		return nil, fmt.Errorf("step must be positive")
+	}
+	if count-1 > (math.MaxUint64-start)/step { //start+(count-1)*step 溢出
+		return nil, fmt.Errorf("end block exceeds %d", uint64(math.MaxUint64))
+	}
+	blockList := make([]uint64, 0, count)
+	for i := uint64(0); i < count; i++ {
+		blockList = append(blockList, start+i*step)
+	}
+	return blockList, nil
+}
+
+// 读取 JSON 格式的区块列表
+// 数组的元素可以是区块号、表达式字符串（例如区块 Hash）或带有 block_number / number 字段的对象
+func readBlockJSON(path string, db ethdb.Database) ([]uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var itemList []interface{}
+	if err := json.Unmarshal(data, &itemList); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	blockList := []uint64{}
+	for _, item := range itemList {
+		switch value := item.(type) {
+		case float64:
+			blockList = append(blockList, uint64(value))
+		case string:
+			numberList, err := parseBlockItem(value, db)
+			if err != nil {
+				return nil, err
+			}
+			blockList = append(blockList, numberList...)
+		case map[string]interface{}:
+			found := false
+			for _, key := range []string{"block_number", "number", "BlockNumber"} {
+				if number, ok := value[key].(float64); ok {
+					blockList = append(blockList, uint64(number))
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("%s: object without block number: %v", path, value)
+			}
+		default:
+			return nil, fmt.Errorf("%s: unsupported item: %v", path, value)
+		}
+	}
+	return blockList, nil
+}
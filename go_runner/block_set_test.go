@@ -0,0 +1,136 @@
+package main
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// 内存数据库，包含 0 到 head 的区块头，返回数据库和每个区块的 Hash
+func testHeaderDB(t *testing.T, head uint64) (ethdb.Database, []string) {
+	t.Helper()
+	db := rawdb.NewMemoryDatabase()
+	hashList := []string{}
+	for number := uint64(0); number <= head; number++ {
+		header := &types.Header{Number: new(big.Int).SetUint64(number), Difficulty: big.NewInt(0)}
+		rawdb.WriteHeader(db, header)
+		rawdb.WriteCanonicalHash(db, header.Hash(), number)
+		rawdb.WriteHeadHeaderHash(db, header.Hash())
+		hashList = append(hashList, header.Hash().Hex())
+	}
+	return db, hashList
+}
+
+func TestParseBlockSet(t *testing.T) {
+	testList := []struct {
+		spec string
+		want []uint64
+	}{
+		{"9833300", []uint64{9833300}},
+		{"100-103", []uint64{100, 101, 102, 103}},
+		{"100:3", []uint64{100, 101, 102}},
+		{"100:3:10", []uint64{100, 110, 120}},
+		{"5, 1-3, 2", []uint64{5, 1, 2, 3}},
+		{"7,7,7", []uint64{7}},
+	}
+	for _, test := range testList {
+		got, err := ParseBlockSet(test.spec, nil)
+		if err != nil {
+			t.Errorf("%q: %v", test.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: ParseBlockSet = %v, want %v", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestParseBlockSetInvalid(t *testing.T) {
+	for _, spec := range []string{"", ",", "abc", "10-5", "1:2:0", "1:2:3:4", "latest-0", "latest", "0x" + "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"} {
+		if got, err := ParseBlockSet(spec, nil); err == nil {
+			t.Errorf("%q: ParseBlockSet = %v, want error", spec, got)
+		}
+	}
+}
+
+// 区块数过多或者最后一个区块号溢出的区间返回错误，而不是耗尽内存或者回绕
+func TestParseBlockSetRangeBound(t *testing.T) {
+	testList := []string{
+		"9800000:18446744073709551615",
+		"0-18446744073709551615",
+		"9800000-18446744073709551615",
+		"18446744073709551615:2",
+		"18446744073709551000:2:1000",
+		"1:50000001",
+		"100:0",
+	}
+	for _, spec := range testList {
+		if got, err := ParseBlockSet(spec, nil); err == nil {
+			t.Errorf("%q: ParseBlockSet returned %d blocks, want error", spec, len(got))
+		}
+	}
+
+	//区间的末尾正好是最大的区块号
+	got, err := ParseBlockSet("18446744073709551614-18446744073709551615,18446744073709550615:2:1000", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []uint64{18446744073709551614, 18446744073709551615, 18446744073709550615}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseBlockSet = %v, want %v", got, want)
+	}
+}
+
+func TestParseBlockSetDatabase(t *testing.T) {
+	db, hashList := testHeaderDB(t, 10)
+	testList := []struct {
+		spec string
+		want []uint64
+	}{
+		{"latest", []uint64{10}},
+		{"latest-3", []uint64{8, 9, 10}},
+		{"latest-100", []uint64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		{hashList[4], []uint64{4}},
+		{hashList[4] + ",latest-1", []uint64{4, 10}},
+	}
+	for _, test := range testList {
+		got, err := ParseBlockSet(test.spec, db)
+		if err != nil {
+			t.Errorf("%q: %v", test.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: ParseBlockSet = %v, want %v", test.spec, got, test.want)
+		}
+	}
+	if _, err := ParseBlockSet("0x00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", db); err == nil {
+		t.Error("unknown block hash should fail")
+	}
+}
+
+func TestParseBlockSetFiles(t *testing.T) {
+	db, hashList := testHeaderDB(t, 10)
+	testList := []struct {
+		name    string
+		content string
+		want    []uint64
+	}{
+		{"blocks.csv", "block_number,gas_used\n3,100\n5,200\n", []uint64{3, 5}},
+		{"blocks.txt", "3\n5\n", []uint64{3, 5}},
+		{"blocks.json", `[3, "6-7", {"block_number": 9}, {"number": 1}, "` + hashList[2] + `"]`, []uint64{3, 6, 7, 9, 1, 2}},
+	}
+	for _, test := range testList {
+		got, err := ParseBlockSet(writeTestFile(t, test.name, test.content)+",4", db)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if want := append(test.want, 4); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: ParseBlockSet = %v, want %v", test.name, got, want)
+		}
+	}
+}
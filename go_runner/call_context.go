@@ -0,0 +1,114 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件在执行区块时用 EVMLogger 记录每笔交易的调用树，用于确定每个 CallQueue 项的存储地址
+//Hook 记录的 ContractAddr 是代码所在的地址，DELEGATECALL（以及 CALLCODE）执行的是实现合约的代码，读写的却是调用者（代理合约）的存储
+//Hook 没有记录调用类型，所以 SLOAD/SSTORE 等对自身的读写要根据 EVMLogger 得到的存储地址归属到代理合约（例如 USDC）
+//只有 BuildAccessSets 需要这些数据，所以只在用到读写集合的子命令中开启（-storage-context），避免影响 replay 等子命令的计时
+//--------------------------------------------------------------------------------------
+
+import (
+	"flag"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/parallel"
+)
+
+// 为 true 时执行区块时记录调用树
+var traceCallContext bool = false
+
+// 最近一次执行的区块的调用树，与 Hook 的数据一样是全局的，读取时要持有 hookLock
+var lastCallContext *callContextTracer
+
+// 给子命令添加 -storage-context 和 -revert-policy 参数，这些子命令默认开启 -storage-context
+func callContextFlags(flagSet *flag.FlagSet) {
+	traceCallContext = true
+	flagSet.BoolVar(&traceCallContext, "storage-context", traceCallContext, "attribute storage accesses under DELEGATECALL/CALLCODE to the calling contract and track reverted calls (runs blocks with an EVMLogger)")
+	flagSet.TextVar(&revertPolicy, "revert-policy", revertPolicy, "writes in reverted calls and failed transactions: keep, read or exclude (needs -storage-context)")
+}
+
+// 记录一个区块中每笔交易调用树的 EVMLogger，单个 opcode 只记录账户级读操作（见 account_read.go）
+type callContextTracer struct {
+	blockHash common.Hash
+	treeList  []*CallFrame //按交易顺序，下标与 BlockInfo.Tx 相同
+	inTx      bool         //beacon root 等系统调用不在交易中，不记录
+
+	callFrameRecorder
+}
+
+// 保证 callContextTracer 实现了 EVMLogger
+var _ vm.EVMLogger = (*callContextTracer)(nil)
+
+func newCallContextTracer(blockHash common.Hash) *callContextTracer {
+	return &callContextTracer{blockHash: blockHash}
+}
+
+func (t *callContextTracer) CaptureTxStart(gasLimit uint64) {
+	t.inTx = true
+	t.callFrameRecorder = callFrameRecorder{}
+}
+
+func (t *callContextTracer) CaptureTxEnd(restGas uint64) {
+	t.treeList = append(t.treeList, t.root)
+	t.inTx = false
+}
+
+func (t *callContextTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	if !t.inTx {
+		return
+	}
+	t.precompiles = activePrecompiles(env)
+	typ := vm.CALL.String()
+	if create {
+		typ = vm.CREATE.String()
+	}
+	t.enterFrame(typ, from, to, value)
+}
+
+func (t *callContextTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {
+	if t.inTx {
+		t.exitFrame(gasUsed, err)
+	}
+}
+
+func (t *callContextTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	if t.inTx {
+		t.enterFrame(typ.String(), from, to, value)
+	}
+}
+
+func (t *callContextTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	if t.inTx {
+		t.exitFrame(gasUsed, err)
+	}
+}
+
+func (t *callContextTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if t.inTx {
+		t.recordAccountRead(op, scope)
+	}
+}
+func (t *callContextTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+// 得到区块的调用树，没有记录或者不是同一个区块时返回 nil
+func blockCallTrees(blockInfo *parallel.BlockInfo) []*CallFrame {
+	if lastCallContext == nil || lastCallContext.blockHash != blockInfo.BlockHash || len(lastCallContext.treeList) != len(blockInfo.Tx) {
+		return nil
+	}
+	return lastCallContext.treeList
+}
+
+// 一笔交易每个 CallQueue 项的存储地址，没有调用树或者对不上时使用 Hook 记录的 ContractAddr（init code 见 creation.go）
+func storageContexts(tree *CallFrame, tx *parallel.TxInfo) []common.Address {
+	contextList := initCodeContexts(tx)
+	matchList := matchCallQueue(tree, tx.CallQueue)
+	for i := range tx.CallQueue {
+		if frame := matchList[i]; frame != nil && frame.Storage != "" {
+			contextList[i] = common.HexToAddress(frame.Storage)
+		}
+	}
+	return contextList
+}
@@ -0,0 +1,400 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件把 Hook 的 CallQueue（按 Layer 排列的调用过程）还原为调用树：调用者 -> 被调用者
+//CallQueue 中没有调用类型、gas 和时间，这些信息来自 EVMLogger（见 tx_replay.go 的 opcodeTracer 和 call_context.go），两者按调用顺序对齐
+//调用树可以输出为缩进的文本、JSON 和 DOT 子图，节点的颜色表示该调用是否读写了状态（即可能导致冲突）
+//--------------------------------------------------------------------------------------
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/parallel"
+)
+
+// 调用树中的一个调用过程
+type CallFrame struct {
+	Depth        int          `json:"depth"`          //根为 0
+	Type         string       `json:"type"`           //CALL、DELEGATECALL、STATICCALL、CALLCODE、CREATE、CREATE2，没有 EVMLogger 且无法推断时为空
+	Kind         string       `json:"kind,omitempty"` //precompile 或 system（见 precompile.go），普通合约为空
+	Name         string       `json:"name,omitempty"` //预编译合约或系统合约的名称
+	From         string       `json:"from"`
+	To           string       `json:"to"`                //代码所在的地址
+	Storage      string       `json:"storage,omitempty"` //存储所属的地址，DELEGATECALL 和 CALLCODE 使用调用者的存储，只有 EVMLogger 能得到
+	Value        string       `json:"value,omitempty"`
+	GasUsed      uint64       `json:"gas_used"`
+	TimeNs       int64        `json:"time_ns"`
+	Error        string       `json:"error,omitempty"`
+	Reverted     bool         `json:"reverted,omitempty"` //自身或者祖先出错，写操作都被回滚（见 revert.go）
+	KeyOpcode    []string     `json:"key_opcode,omitempty"`
+	AccountReads []string     `json:"account_reads,omitempty"` //EVMLogger 记录的账户级读操作（见 account_read.go），格式与 KeyOpcode 相同
+	Children     []*CallFrame `json:"children,omitempty"`
+}
+
+// 调用过程中对状态的读写（根据 KeyOpcode 和 AccountReads 判断）
+func (f *CallFrame) access() (read bool, write bool) {
+	keyOpcodeList := append(append([]string{}, f.KeyOpcode...), f.AccountReads...)
+	for _, keyOpcode := range keyOpcodeList {
+		split := strings.Split(keyOpcode, " ")
+		if len(split) < 2 {
+			continue
+		}
+		switch split[1] {
+		case "SLOAD", "BALANCE", "SELFBALANCE", "EXTCODESIZE", "EXTCODEHASH", "EXTCODECOPY", "STATICCALL", "DELEGATECALL", "CALLCODE":
+			read = true
+		case "SSTORE", "SELFDESTRUCT", "CREATE", "CREATE2":
+			write = true
+		case "TLOAD", "TSTORE": //transient storage 不是状态（见 cancun.go）
+		case "CALL":
+			if len(split) > 3 && split[3] == "doTransfer_true" {
+				read, write = true, true
+			}
+		}
+	}
+	return read, write
+}
+
+// 按先序遍历调用树
+func (f *CallFrame) walk(visit func(frame *CallFrame)) {
+	visit(f)
+	for _, child := range f.Children {
+		child.walk(visit)
+	}
+}
+
+// 根据 KeyOpcode 推断子调用的类型（Hook 只记录 CALL 和 CREATE），推断不出时返回空
+// Hook 为 init code 记录零地址时，按顺序对应调用者的第几个 CREATE/CREATE2（见 creation.go）
+func inferCallType(parent *CallFrame, to string) string {
+	if common.HexToAddress(to) == (common.Address{}) {
+		created := 0 //已经对应的 CREATE/CREATE2 子调用
+		for _, child := range parent.Children {
+			if child.Type == "CREATE" || child.Type == "CREATE2" {
+				created++
+			}
+		}
+		for _, keyOpcode := range parent.KeyOpcode {
+			if split := strings.Split(keyOpcode, " "); len(split) >= 3 && (split[1] == "CREATE" || split[1] == "CREATE2") {
+				if created == 0 {
+					return split[1]
+				}
+				created--
+			}
+		}
+		return ""
+	}
+	for _, keyOpcode := range parent.KeyOpcode {
+		split := strings.Split(keyOpcode, " ")
+		if len(split) >= 3 && strings.EqualFold(split[2], to) {
+			switch split[1] {
+			case "CALL", "CREATE", "CREATE2":
+				return split[1]
+			}
+		}
+	}
+	return ""
+}
+
+// 只根据 Hook 的数据构建一笔交易的调用树
+// CallQueue 中子调用返回之后，调用者会以同样的 Layer 和地址再出现一次，这种情况合并到原来的调用过程中
+func BuildCallTree(tx *parallel.TxInfo) *CallFrame {
+	if len(tx.CallQueue) == 0 {
+		return nil
+	}
+	minLayer := tx.CallQueue[0].Layer
+	for _, call := range tx.CallQueue {
+		if call.Layer < minLayer {
+			minLayer = call.Layer
+		}
+	}
+
+	root := &CallFrame{Type: "CALL", From: tx.From.Hex(), To: tx.CallQueue[0].ContractAddr.Hex()}
+	if isContractCreation(tx) {
+		root.Type = "CREATE"
+	}
+	if tx.Value != nil {
+		root.Value = tx.Value.String()
+	}
+
+	stack := []*CallFrame{}
+	for _, call := range tx.CallQueue {
+		depth := call.Layer - minLayer
+		addr := call.ContractAddr.Hex()
+		returned := false
+		for len(stack) > 0 && stack[len(stack)-1].Depth > depth {
+			stack = stack[:len(stack)-1]
+			returned = true
+		}
+		if len(stack) > 0 && stack[len(stack)-1].Depth == depth {
+			top := stack[len(stack)-1]
+			if returned && top.To == addr { //子调用返回之后继续执行
+				top.KeyOpcode = append(top.KeyOpcode, call.KeyOpcode...)
+				continue
+			}
+			stack = stack[:len(stack)-1]
+		}
+
+		var frame *CallFrame
+		if len(stack) == 0 {
+			if len(root.KeyOpcode) > 0 || root.To != addr { //第二个根，不应该出现，作为根的子调用处理
+				frame = &CallFrame{Depth: depth, From: root.To, To: addr}
+				root.Children = append(root.Children, frame)
+			} else {
+				frame = root
+			}
+		} else {
+			parent := stack[len(stack)-1]
+			frame = &CallFrame{Depth: depth, From: parent.To, To: addr, Type: inferCallType(parent, addr)}
+			parent.Children = append(parent.Children, frame)
+		}
+		frame.KeyOpcode = append(frame.KeyOpcode, call.KeyOpcode...)
+		stack = append(stack, frame)
+	}
+	return root
+}
+
+// 在 EVMLogger 中记录调用树，CaptureStart/CaptureEnter 时调用 enterFrame，CaptureEnd/CaptureExit 时调用 exitFrame
+type callFrameRecorder struct {
+	precompiles map[common.Address]bool //区块所在硬分叉中启用的预编译合约，CaptureStart 时设置
+
+	root       *CallFrame
+	frameStack []*CallFrame
+	startStack []time.Time //每个调用过程开始的时间
+}
+
+// 开始一个调用过程
+func (r *callFrameRecorder) enterFrame(typ string, from common.Address, to common.Address, value *big.Int) {
+	frame := &CallFrame{Depth: len(r.frameStack), Type: typ, From: from.Hex(), To: to.Hex(), Storage: to.Hex()}
+	if typ == vm.DELEGATECALL.String() || typ == vm.CALLCODE.String() { //from 就是调用者的存储地址
+		frame.Storage = from.Hex()
+	}
+	if value != nil {
+		frame.Value = value.String()
+	}
+	frame.Kind, frame.Name = classifyFrame(to, r.precompiles)
+	if len(r.frameStack) == 0 {
+		r.root = frame
+	} else {
+		parent := r.frameStack[len(r.frameStack)-1]
+		parent.Children = append(parent.Children, frame)
+	}
+	r.frameStack = append(r.frameStack, frame)
+	r.startStack = append(r.startStack, time.Now())
+}
+
+// 结束当前的调用过程
+func (r *callFrameRecorder) exitFrame(gasUsed uint64, err error) {
+	if len(r.frameStack) == 0 {
+		return
+	}
+	last := len(r.frameStack) - 1
+	frame := r.frameStack[last]
+	frame.GasUsed = gasUsed
+	frame.TimeNs = time.Since(r.startStack[last]).Nanoseconds()
+	if err != nil {
+		frame.Error = err.Error()
+	}
+	r.frameStack, r.startStack = r.frameStack[:last], r.startStack[:last]
+	if last == 0 { //最外层调用结束
+		frame.markReverted(false)
+	}
+}
+
+// 把 Hook 的 KeyOpcode 附加到 EVMLogger 得到的调用树上
+func AttachKeyOpcodes(root *CallFrame, callQueue []*parallel.CallInfo) {
+	for i, frame := range matchCallQueue(root, callQueue) {
+		if frame != nil {
+			frame.KeyOpcode = append(frame.KeyOpcode, callQueue[i].KeyOpcode...)
+		}
+	}
+}
+
+// 调用过程的地址是否与 Hook 记录的地址相同（代码地址和存储地址都可以），Hook 为 init code 记录零地址时与 CREATE/CREATE2 相同
+func (f *CallFrame) hasAddr(addr common.Address) bool {
+	if addr == (common.Address{}) && (f.Type == "CREATE" || f.Type == "CREATE2") {
+		return true
+	}
+	return common.HexToAddress(f.To) == addr || (f.Storage != "" && common.HexToAddress(f.Storage) == addr)
+}
+
+// 找到每个 CallQueue 项在 EVMLogger 得到的调用树中对应的调用过程，找不到时为 nil
+// 每个 CallQueue 项对应先序遍历中下一个深度和地址都相同的调用过程，找不到时视为子调用返回后的继续执行，对应最近的同一调用过程
+func matchCallQueue(root *CallFrame, callQueue []*parallel.CallInfo) []*CallFrame {
+	matchList := make([]*CallFrame, len(callQueue))
+	if root == nil || len(callQueue) == 0 {
+		return matchList
+	}
+	minLayer := callQueue[0].Layer
+	for _, call := range callQueue {
+		if call.Layer < minLayer {
+			minLayer = call.Layer
+		}
+	}
+	frameList := []*CallFrame{}
+	root.walk(func(frame *CallFrame) { frameList = append(frameList, frame) })
+
+	next := 0
+	stack := []*CallFrame{}      //当前正在执行的调用过程
+	var lastMatched []*CallFrame //已经匹配的调用过程
+	for j, call := range callQueue {
+		depth := call.Layer - minLayer
+		returned := false
+		for len(stack) > 0 && stack[len(stack)-1].Depth > depth {
+			stack = stack[:len(stack)-1]
+			returned = true
+		}
+		var target *CallFrame
+		if top := len(stack) - 1; returned && top >= 0 && stack[top].Depth == depth && stack[top].hasAddr(call.ContractAddr) {
+			target = stack[top] //子调用返回之后继续执行
+		}
+		for i := next; target == nil && i < len(frameList); i++ {
+			if frameList[i].Depth == depth && frameList[i].hasAddr(call.ContractAddr) {
+				target = frameList[i]
+				next = i + 1
+			}
+		}
+		for i := len(lastMatched) - 1; target == nil && i >= 0; i-- {
+			if lastMatched[i].Depth == depth && lastMatched[i].hasAddr(call.ContractAddr) {
+				target = lastMatched[i]
+			}
+		}
+		if target == nil {
+			logger.Debug("call queue entry without matching frame", "layer", call.Layer, "contract", call.ContractAddr)
+			continue
+		}
+		matchList[j] = target
+		lastMatched = append(lastMatched, target)
+		if len(stack) > 0 && stack[len(stack)-1].Depth == depth {
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, target)
+	}
+	return matchList
+}
+
+// 一个调用过程的摘要
+func (f *CallFrame) summary() string {
+	text := fmt.Sprintf("%s %s -> %s", f.Type, f.From, f.To)
+	if f.Type == "" {
+		text = fmt.Sprintf("%s -> %s", f.From, f.To)
+	}
+	if f.Kind != "" {
+		text += " [" + f.Kind + " " + f.Name + "]"
+	}
+	if f.Storage != "" && f.Storage != f.To {
+		text += " storage=" + f.Storage
+	}
+	if f.Value != "" && f.Value != "0" {
+		text += " value=" + f.Value
+	}
+	if f.GasUsed > 0 || f.TimeNs > 0 {
+		text += fmt.Sprintf(" gas=%d time=%dns", f.GasUsed, f.TimeNs)
+	}
+	if read, write := f.access(); read || write {
+		text += " [" + accessLabel(&AccountAccess{Read: read, Write: write}) + "]"
+	}
+	if f.Error != "" {
+		text += " error=" + f.Error
+	} else if f.Reverted {
+		text += " reverted"
+	}
+	return text
+}
+
+// 输出缩进的文本
+func (f *CallFrame) WriteText(w io.Writer) {
+	f.walk(func(frame *CallFrame) {
+		indent := strings.Repeat("\t", frame.Depth)
+		fmt.Fprintf(w, "%s%s\n", indent, frame.summary())
+		for _, op := range frame.KeyOpcode {
+			fmt.Fprintf(w, "%s\t  %s\n", indent, op)
+		}
+		for _, op := range frame.AccountReads {
+			fmt.Fprintf(w, "%s\t  %s\n", indent, op)
+		}
+	})
+}
+
+// 输出 DOT 子图（cluster），可以嵌入其他图中，name 为子图名称（同时作为节点名前缀）
+// 写状态的调用过程为红色，只读状态的为黄色，没有读写状态的为白色，回滚的调用过程为虚线，预编译合约和系统合约为蓝色椭圆
+func (f *CallFrame) toDOTSubgraph(name string) string {
+	dot := "subgraph cluster_" + name + " {\n"
+	dot += "\tlabel=\"" + name + "\";\n"
+	id := 0
+	var visit func(frame *CallFrame, parentNode string)
+	visit = func(frame *CallFrame, parentNode string) {
+		node := fmt.Sprintf("%s_%d", name, id)
+		id++
+		color := "white"
+		if read, write := frame.access(); write {
+			color = "tomato"
+		} else if read {
+			color = "khaki"
+		}
+		label := frame.Type + "\\n" + frame.To
+		shape := "box"
+		if frame.Kind != "" { //预编译合约和系统合约
+			label += "\\n" + frame.Kind + " " + frame.Name
+			shape, color = "ellipse", "lightblue"
+		}
+		if frame.Storage != "" && frame.Storage != frame.To {
+			label += "\\nstorage " + frame.Storage
+		}
+		if frame.GasUsed > 0 || frame.TimeNs > 0 {
+			label += fmt.Sprintf("\\ngas %d / %dns", frame.GasUsed, frame.TimeNs)
+		}
+		style := "filled"
+		if frame.Reverted { //回滚的调用过程画为虚线
+			style = "\"filled,dashed\""
+		}
+		dot += fmt.Sprintf("\t%s [shape=%s style=%s fillcolor=%s fontname=\"Courier New\" label=\"%s\"];\n", node, shape, style, color, label)
+		if parentNode != "" {
+			edgeLabel := frame.Type
+			if frame.Value != "" && frame.Value != "0" {
+				edgeLabel += " value=" + frame.Value
+			}
+			edgeStyle := "solid"
+			if frame.Reverted {
+				edgeStyle = "dashed"
+			}
+			dot += fmt.Sprintf("\t%s -> %s [label=\"%s\" style=%s];\n", parentNode, node, revertedLabel(edgeLabel, frame.Reverted), edgeStyle)
+		}
+		for _, child := range frame.Children {
+			visit(child, node)
+		}
+	}
+	visit(f, "")
+	return dot + "}\n"
+}
+
+// 输出完整的 DOT 图
+func (f *CallFrame) toDOT(name string) string {
+	return "digraph G {\n\trankdir=\"TB\";\n" + f.toDOTSubgraph(name) + "}\n"
+}
+
+// 统计调用树中每个预编译合约的次数、时间和 gas（见 precompile.go），按时间从大到小排序
+func precompileStats(root *CallFrame) []PrecompileStat {
+	if root == nil {
+		return nil
+	}
+	statMap := make(map[string]*PrecompileStat)
+	root.walk(func(frame *CallFrame) {
+		if frame.Kind != framePrecompile {
+			return
+		}
+		stat, ok := statMap[frame.To]
+		if !ok {
+			stat = &PrecompileStat{Name: frame.Name, Address: frame.To}
+			statMap[frame.To] = stat
+		}
+		stat.Count++
+		stat.TimeNs += frame.TimeNs
+		stat.Gas += frame.GasUsed
+	})
+	return sortedPrecompileStats(statMap)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/parallel"
+)
+
+var (
+	testEOA   = common.HexToAddress("0x00000000000000000000000000000000000000e0")
+	testProxy = common.HexToAddress("0x00000000000000000000000000000000000000a0")
+	testImpl  = common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	testToken = common.HexToAddress("0x00000000000000000000000000000000000000b0")
+	testOther = common.HexToAddress("0x00000000000000000000000000000000000000c0")
+	testSha   = common.HexToAddress("0x0000000000000000000000000000000000000002")
+)
+
+// EVMLogger 得到的调用树：
+// CALL eoa -> proxy
+//
+//	DELEGATECALL proxy -> impl（存储属于 proxy）
+//	STATICCALL proxy -> sha256（预编译合约，Hook 没有记录）
+//	CALL proxy -> token
+//		STATICCALL token -> other
+func testCallTree() (*CallFrame, []*CallFrame) {
+	deleg := &CallFrame{Depth: 1, Type: "DELEGATECALL", From: testProxy.Hex(), To: testImpl.Hex(), Storage: testProxy.Hex()}
+	sha := &CallFrame{Depth: 1, Type: "STATICCALL", From: testProxy.Hex(), To: testSha.Hex(), Storage: testSha.Hex(), Kind: "precompile", Name: "sha256"}
+	other := &CallFrame{Depth: 2, Type: "STATICCALL", From: testToken.Hex(), To: testOther.Hex(), Storage: testOther.Hex()}
+	token := &CallFrame{Depth: 1, Type: "CALL", From: testProxy.Hex(), To: testToken.Hex(), Storage: testToken.Hex(), Children: []*CallFrame{other}}
+	root := &CallFrame{Type: "CALL", From: testEOA.Hex(), To: testProxy.Hex(), Storage: testProxy.Hex(), Children: []*CallFrame{deleg, sha, token}}
+	return root, []*CallFrame{root, deleg, sha, token, other}
+}
+
+// Hook 的 CallQueue：子调用返回之后调用者以同样的 Layer 再出现一次
+func testCallQueue() []*parallel.CallInfo {
+	return []*parallel.CallInfo{
+		{Layer: 1, ContractAddr: testProxy, KeyOpcode: []string{"[Read] SLOAD 0x01"}},
+		{Layer: 2, ContractAddr: testImpl, KeyOpcode: []string{"[Write] SSTORE 0x02 0x03"}},
+		{Layer: 1, ContractAddr: testProxy, KeyOpcode: []string{"[Read&Write] CALL " + testToken.Hex() + " doTransfer_false"}},
+		{Layer: 2, ContractAddr: testToken, KeyOpcode: []string{"[Write] SSTORE 0x04 0x05"}},
+		{Layer: 3, ContractAddr: testOther, KeyOpcode: []string{"[Read] SLOAD 0x06"}},
+		{Layer: 2, ContractAddr: testToken},
+		{Layer: 1, ContractAddr: testProxy, KeyOpcode: []string{"[Read] SLOAD 0x07"}},
+	}
+}
+
+func TestMatchCallQueue(t *testing.T) {
+	root, frameList := testCallTree()
+	deleg, token, other := frameList[1], frameList[3], frameList[4]
+	want := []*CallFrame{root, deleg, root, token, other, token, root}
+	got := matchCallQueue(root, testCallQueue())
+	if len(got) != len(want) {
+		t.Fatalf("matchCallQueue returned %d frames, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d matched %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestMatchCallQueueUnmatched(t *testing.T) {
+	root, _ := testCallTree()
+	callQueue := []*parallel.CallInfo{
+		{Layer: 1, ContractAddr: testProxy},
+		{Layer: 2, ContractAddr: testOther}, //调用树中 other 在第 2 层
+	}
+	got := matchCallQueue(root, callQueue)
+	if got[0] != root || got[1] != nil {
+		t.Errorf("matchCallQueue = %v, want [root nil]", got)
+	}
+	for _, frame := range matchCallQueue(nil, callQueue) {
+		if frame != nil {
+			t.Error("matchCallQueue without call tree should not match")
+		}
+	}
+}
+
+func TestStorageContexts(t *testing.T) {
+	root, _ := testCallTree()
+	tx := &parallel.TxInfo{From: testEOA, To: testProxy.Hex(), CallQueue: testCallQueue()}
+	want := []common.Address{testProxy, testProxy, testProxy, testToken, testOther, testToken, testProxy}
+	if got := storageContexts(root, tx); !reflect.DeepEqual(got, want) {
+		t.Errorf("storageContexts = %v, want %v", got, want)
+	}
+	//没有调用树时使用 Hook 记录的 ContractAddr
+	want = []common.Address{testProxy, testImpl, testProxy, testToken, testOther, testToken, testProxy}
+	if got := storageContexts(nil, tx); !reflect.DeepEqual(got, want) {
+		t.Errorf("storageContexts without call tree = %v, want %v", got, want)
+	}
+}
+
+func TestAttachKeyOpcodes(t *testing.T) {
+	root, frameList := testCallTree()
+	AttachKeyOpcodes(root, testCallQueue())
+	wantList := [][]string{
+		{"[Read] SLOAD 0x01", "[Read&Write] CALL " + testToken.Hex() + " doTransfer_false", "[Read] SLOAD 0x07"},
+		{"[Write] SSTORE 0x02 0x03"},
+		nil,
+		{"[Write] SSTORE 0x04 0x05"},
+		{"[Read] SLOAD 0x06"},
+	}
+	for i, frame := range frameList {
+		if !reflect.DeepEqual(frame.KeyOpcode, wantList[i]) {
+			t.Errorf("%s: KeyOpcode = %v, want %v", frame.To, frame.KeyOpcode, wantList[i])
+		}
+	}
+}
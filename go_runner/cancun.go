@@ -0,0 +1,119 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件处理 Cancun 之后的 opcode 和 blob 交易（type 3），使分析工具可以在最近的主网区块上运行
+//	TLOAD/TSTORE  transient storage 只在一笔交易内有效，交易结束时清空，不算作读写冲突
+//	MCOPY         只操作内存
+//	BLOBHASH      读取交易的 blob versioned hash
+//	BLOBBASEFEE   读取区块头的 blob base fee
+//这些 opcode 都不访问其他账户，读写集合中直接忽略；opcode 统计中按类别区分，transient storage 不与 SLOAD/SSTORE 混在一起
+//replay-tx 和区块范围的 opcode 统计（db.go）都按类别汇总，本文件不使用日志，与 db.go 一起单独编译
+//blob 交易由 geth 本身执行，validate.go 检查区块头的 blob gas used（-validate），replay-tx 输出 blob 的信息
+//Cancun 之后的主网区块从 19426587 开始，例如: go run . replay -blocks 19426587:100:1000 -validate
+//--------------------------------------------------------------------------------------
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// opcode 的类别，用于 opcode 统计
+func opcodeCategory(op vm.OpCode) string {
+	switch op {
+	case vm.SLOAD, vm.SSTORE:
+		return "storage"
+	case vm.TLOAD, vm.TSTORE:
+		return "transient"
+	case vm.MLOAD, vm.MSTORE, vm.MSTORE8, vm.MCOPY, vm.CALLDATACOPY, vm.CODECOPY, vm.RETURNDATACOPY:
+		return "memory"
+	case vm.BLOBHASH, vm.BLOBBASEFEE:
+		return "blob"
+	case vm.BALANCE, vm.SELFBALANCE, vm.EXTCODESIZE, vm.EXTCODEHASH, vm.EXTCODECOPY:
+		return "account"
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		return "call"
+	case vm.CREATE, vm.CREATE2, vm.SELFDESTRUCT:
+		return "create"
+	case vm.KECCAK256:
+		return "hash"
+	case vm.LOG0, vm.LOG1, vm.LOG2, vm.LOG3, vm.LOG4:
+		return "log"
+	}
+	return "other"
+}
+
+// 一种 opcode 的统计
+type OpcodeStat struct {
+	Opcode   string `json:"opcode"`
+	Category string `json:"category"` //见 opcodeCategory
+	Count    int64  `json:"count"`
+	TimeNs   int64  `json:"time_ns"` //replay-tx 中为从这个 opcode 开始到下一个 opcode 开始的时间，包括 EVMLogger 本身的开销
+	Gas      uint64 `json:"gas"`
+}
+
+// 一个类别的统计
+type OpcodeCategoryStat struct {
+	Category string `json:"category"`
+	Count    int64  `json:"count"`
+	TimeNs   int64  `json:"time_ns"`
+	Gas      uint64 `json:"gas"`
+}
+
+// 按类别汇总 opcode 统计，按时间从大到小排序
+func opcodeCategoryStats(statList []OpcodeStat) []OpcodeCategoryStat {
+	categoryMap := make(map[string]*OpcodeCategoryStat)
+	for _, stat := range statList {
+		category, ok := categoryMap[stat.Category]
+		if !ok {
+			category = &OpcodeCategoryStat{Category: stat.Category}
+			categoryMap[stat.Category] = category
+		}
+		category.Count += stat.Count
+		category.TimeNs += stat.TimeNs
+		category.Gas += stat.Gas
+	}
+	categoryList := make([]OpcodeCategoryStat, 0, len(categoryMap))
+	for _, category := range categoryMap {
+		categoryList = append(categoryList, *category)
+	}
+	sort.Slice(categoryList, func(i, j int) bool {
+		if categoryList[i].TimeNs != categoryList[j].TimeNs {
+			return categoryList[i].TimeNs > categoryList[j].TimeNs
+		}
+		return categoryList[i].Category < categoryList[j].Category
+	})
+	return categoryList
+}
+
+// 按类别汇总以 opcode 名称为 key 的次数和时间（插桩 geth 的 op_count 和 op_time），无法识别的名称归为 other
+func opcodeCategoryTotals(countMap map[string]int64, timeMap map[string]int64) []OpcodeCategoryStat {
+	statMap := make(map[string]*OpcodeStat)
+	stat := func(name string) *OpcodeStat {
+		if _, ok := statMap[name]; !ok {
+			statMap[name] = &OpcodeStat{Opcode: name, Category: opcodeCategory(vm.StringToOp(name))}
+		}
+		return statMap[name]
+	}
+	for name, count := range countMap {
+		stat(name).Count += count
+	}
+	for name, timeValue := range timeMap {
+		stat(name).TimeNs += timeValue
+	}
+	statList := make([]OpcodeStat, 0, len(statMap))
+	for _, s := range statMap {
+		statList = append(statList, *s)
+	}
+	return opcodeCategoryStats(statList)
+}
+
+// 输出按类别汇总的 opcode 统计
+func writeOpcodeCategoryStats(w io.Writer, categoryList []OpcodeCategoryStat) {
+	for _, category := range categoryList {
+		fmt.Fprintf(w, "\t%-16s count: %-8d time: %-12s gas: %d\n", category.Category, category.Count, time.Duration(category.TimeNs), category.Gas)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/parallel"
+)
+
+func TestOpcodeCategory(t *testing.T) {
+	testList := []struct {
+		op   vm.OpCode
+		want string
+	}{
+		{vm.SLOAD, "storage"},
+		{vm.SSTORE, "storage"},
+		{vm.TLOAD, "transient"},
+		{vm.TSTORE, "transient"},
+		{vm.MCOPY, "memory"},
+		{vm.MSTORE, "memory"},
+		{vm.BLOBHASH, "blob"},
+		{vm.BLOBBASEFEE, "blob"},
+		{vm.ADD, "other"},
+	}
+	for _, test := range testList {
+		if got := opcodeCategory(test.op); got != test.want {
+			t.Errorf("opcodeCategory(%v) = %s, want %s", test.op, got, test.want)
+		}
+	}
+}
+
+// 区块范围的 opcode 统计以 opcode 名称为 key，transient storage 不与 SLOAD/SSTORE 合并
+func TestOpcodeCategoryTotals(t *testing.T) {
+	countMap := map[string]int64{"SLOAD": 10, "SSTORE": 2, "TLOAD": 5, "TSTORE": 5, "MCOPY": 3, "BLOBHASH": 1, "BLOBBASEFEE": 1, "UNKNOWN": 4}
+	timeMap := map[string]int64{"SLOAD": 1000, "SSTORE": 500, "TLOAD": 50, "TSTORE": 60, "MCOPY": 30, "BLOBHASH": 7, "BLOBBASEFEE": 8, "UNKNOWN": 1}
+	got := map[string]OpcodeCategoryStat{}
+	for _, category := range opcodeCategoryTotals(countMap, timeMap) {
+		got[category.Category] = category
+	}
+	want := map[string]OpcodeCategoryStat{
+		"storage":   {Category: "storage", Count: 12, TimeNs: 1500},
+		"transient": {Category: "transient", Count: 10, TimeNs: 110},
+		"memory":    {Category: "memory", Count: 3, TimeNs: 30},
+		"blob":      {Category: "blob", Count: 2, TimeNs: 15},
+		"other":     {Category: "other", Count: 4, TimeNs: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("categories = %+v, want %+v", got, want)
+	}
+}
+
+// Cancun 的 opcode 不访问其他账户，读写集合中忽略
+func TestBuildAccessSetsCancunOpcodes(t *testing.T) {
+	sender := common.HexToAddress("0x1111")
+	contract := common.HexToAddress("0x3333")
+	blockInfo := &parallel.BlockInfo{Tx: []*parallel.TxInfo{{From: sender, To: contract.Hex(), Value: big.NewInt(0), CallQueue: []*parallel.CallInfo{
+		{Layer: 1, ContractAddr: contract, KeyOpcode: []string{"[Read] TLOAD 0x01", "[Write] TSTORE 0x01 0x02", "[Read] MCOPY 0x00", "[Read] BLOBHASH 0x00", "[Read] BLOBBASEFEE 0x00"}},
+	}}}}
+	set := BuildAccessSets(blockInfo, common.Address{}, ConflictModel{})[0]
+	if len(set.Accounts) != 0 {
+		t.Errorf("accounts = %v, want none", set.Order)
+	}
+}
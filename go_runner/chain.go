@@ -0,0 +1,170 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件明确选择链配置和共识引擎，不再依赖数据库中保存的配置，也不再对所有区块都只使用 ethash.NewFaker
+//	-chain mainnet|sepolia|holesky  使用 geth 内置的创世区块和链配置（默认 mainnet）
+//	-genesis genesis.json           使用自定义的创世文件（与 geth init 的格式相同），此时忽略 -chain
+//新建数据链时把创世区块传给 core.NewBlockChain：创世区块与数据库不一致时报错，硬分叉配置不兼容时也报错
+//共识引擎按链配置选择：设置了 TerminalTotalDifficulty 的链使用 beacon（合并之后的区块处理 withdrawals，没有区块奖励），
+//合并之前的区块交给 ethash.NewFaker，clique 链交给 clique
+//这里只执行数据库中已有的区块，有意不验证 PoW（ethash.NewFaker 的 Finalize 与真正的 ethash 相同，区块奖励照常计算）
+//每个执行的区块都输出启用的硬分叉（forks），用于确认区块按正确的规则执行
+//db.go 单独运行时也使用本文件，这里不使用 logger
+//--------------------------------------------------------------------------------------
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/beacon"
+	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// 选择的链，genesisFile 不为空时忽略
+var chainName string = "mainnet"
+
+// 自定义的创世文件
+var genesisFile string = ""
+
+// 给子命令添加 -chain 和 -genesis 参数
+func chainFlags(flagSet *flag.FlagSet) {
+	flagSet.Func("chain", "chain of the database: mainnet, sepolia or holesky (default mainnet)", func(value string) error {
+		if _, err := builtinGenesis(value); err != nil {
+			return err
+		}
+		chainName = value
+		return nil
+	})
+	flagSet.StringVar(&genesisFile, "genesis", genesisFile, "custom genesis file, overrides -chain")
+}
+
+// geth 内置的创世区块
+func builtinGenesis(name string) (*core.Genesis, error) {
+	switch name {
+	case "mainnet":
+		return core.DefaultGenesisBlock(), nil
+	case "sepolia":
+		return core.DefaultSepoliaGenesisBlock(), nil
+	case "holesky":
+		return core.DefaultHoleskyGenesisBlock(), nil
+	}
+	return nil, fmt.Errorf("unknown chain: %s", name)
+}
+
+// 当前选择的创世区块
+func chainGenesis() (*core.Genesis, error) {
+	if genesisFile == "" {
+		return builtinGenesis(chainName)
+	}
+	file, err := os.Open(genesisFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	genesis := new(core.Genesis)
+	if err := json.NewDecoder(file).Decode(genesis); err != nil {
+		return nil, fmt.Errorf("%s: %v", genesisFile, err)
+	}
+	if genesis.Config == nil {
+		return nil, fmt.Errorf("%s: missing chain config", genesisFile)
+	}
+	return genesis, nil
+}
+
+// 选择的链的名称，用于输出
+func chainLabel() string {
+	if genesisFile != "" {
+		return genesisFile
+	}
+	return chainName
+}
+
+// 按链配置选择共识引擎
+func newEngine(config *params.ChainConfig, db ethdb.Database) consensus.Engine {
+	var engine consensus.Engine = ethash.NewFaker() //有意不验证 PoW，区块奖励与真正的 ethash 相同
+	if config.Clique != nil {
+		engine = clique.New(config.Clique, db)
+	}
+	if config.TerminalTotalDifficulty != nil {
+		engine = beacon.New(engine)
+	}
+	return engine
+}
+
+// 用选择的创世区块和共识引擎在数据库上新建数据链
+func newChain(db ethdb.Database) (*core.BlockChain, error) {
+	genesis, err := chainGenesis()
+	if err != nil {
+		return nil, err
+	}
+	bc, err := core.NewBlockChain(db, core.DefaultCacheConfigWithScheme(rawdb.HashScheme), genesis, nil, newEngine(genesis.Config, db), vm.Config{}, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("chain %s: %w", chainLabel(), err)
+	}
+	return bc, nil
+}
+
+// 读取数据库中保存的链配置，读取不到则使用选择的链的配置
+func readChainConfig(db ethdb.Database) *params.ChainConfig {
+	genesisHash := rawdb.ReadCanonicalHash(db, 0)
+	if config := rawdb.ReadChainConfig(db, genesisHash); config != nil {
+		return config
+	}
+	if genesis, err := chainGenesis(); err == nil {
+		return genesis.Config
+	}
+	return params.MainnetChainConfig
+}
+
+// 区块启用的所有硬分叉，按启用的先后排列
+// merged 表示区块是否在合并之后（合并之后区块的难度为 0）
+func activeForks(config *params.ChainConfig, number *big.Int, time uint64, merged bool) []string {
+	forkList := []string{"Frontier"}
+	for _, fork := range []struct {
+		name   string
+		active bool
+	}{
+		{"Homestead", config.IsHomestead(number)},
+		{"TangerineWhistle", config.IsEIP150(number)},
+		{"SpuriousDragon", config.IsEIP158(number)},
+		{"Byzantium", config.IsByzantium(number)},
+		{"Constantinople", config.IsConstantinople(number)},
+		{"Petersburg", config.IsPetersburg(number)},
+		{"Istanbul", config.IsIstanbul(number)},
+		{"MuirGlacier", config.IsMuirGlacier(number)},
+		{"Berlin", config.IsBerlin(number)},
+		{"London", config.IsLondon(number)},
+		{"ArrowGlacier", config.IsArrowGlacier(number)},
+		{"GrayGlacier", config.IsGrayGlacier(number)},
+		{"Paris", merged},
+		{"Shanghai", config.IsShanghai(number, time)},
+		{"Cancun", config.IsCancun(number, time)},
+	} {
+		if fork.active {
+			forkList = append(forkList, fork.name)
+		}
+	}
+	return forkList
+}
+
+// 区块所处的硬分叉（最后启用的硬分叉）
+func forkName(config *params.ChainConfig, number *big.Int, time uint64, merged bool) string {
+	forkList := activeForks(config, number, time, merged)
+	return forkList[len(forkList)-1]
+}
+
+// 区块头启用的所有硬分叉
+func headerForks(config *params.ChainConfig, header *types.Header) []string {
+	return activeForks(config, header.Number, header.Time, header.Difficulty.Sign() == 0)
+}
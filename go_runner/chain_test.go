@@ -0,0 +1,72 @@
+package main
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// 主网硬分叉边界前后的区块启用的硬分叉
+func TestActiveForksMainnet(t *testing.T) {
+	config := params.MainnetChainConfig
+	const shanghaiTime, cancunTime = 1681338455, 1710338135
+	preByzantium := []string{"Frontier", "Homestead", "TangerineWhistle", "SpuriousDragon"}
+	preLondon := append(append([]string{}, preByzantium...), "Byzantium", "Constantinople", "Petersburg", "Istanbul", "MuirGlacier", "Berlin")
+	preMerge := append(append([]string{}, preLondon...), "London", "ArrowGlacier", "GrayGlacier")
+	testList := []struct {
+		name   string
+		number uint64
+		time   uint64
+		merged bool
+		want   []string
+	}{
+		{"genesis", 0, 0, false, []string{"Frontier"}},
+		{"before Byzantium", 4369999, 0, false, preByzantium},
+		{"Byzantium", 4370000, 0, false, append(append([]string{}, preByzantium...), "Byzantium")},
+		{"before London", 12964999, 0, false, preLondon},
+		{"London", 12965000, 0, false, append(append([]string{}, preLondon...), "London")},
+		{"last PoW block", 15537393, 1663224162, false, preMerge},
+		{"Merge", 15537394, 1663224179, true, append(append([]string{}, preMerge...), "Paris")},
+		{"before Cancun", 19426586, cancunTime - 1, true, append(append([]string{}, preMerge...), "Paris", "Shanghai")},
+		{"Cancun", 19426587, cancunTime, true, append(append([]string{}, preMerge...), "Paris", "Shanghai", "Cancun")},
+		{"Shanghai", 17034870, shanghaiTime, true, append(append([]string{}, preMerge...), "Paris", "Shanghai")},
+	}
+	for _, test := range testList {
+		number := new(big.Int).SetUint64(test.number)
+		got := activeForks(config, number, test.time, test.merged)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: activeForks = %v, want %v", test.name, got, test.want)
+		}
+		if name := forkName(config, number, test.time, test.merged); name != test.want[len(test.want)-1] {
+			t.Errorf("%s: forkName = %s, want %s", test.name, name, test.want[len(test.want)-1])
+		}
+	}
+}
+
+// 合并由区块头的难度判断
+func TestHeaderForks(t *testing.T) {
+	config := params.MainnetChainConfig
+	testList := []struct {
+		name       string
+		number     uint64
+		time       uint64
+		difficulty int64
+		want       string
+	}{
+		{"Byzantium", 4370000, 1508131331, 1, "Byzantium"},
+		{"London", 12965000, 1628166822, 1, "London"},
+		{"last PoW block", 15537393, 1663224162, 1, "GrayGlacier"},
+		{"Merge", 15537394, 1663224179, 0, "Paris"},
+		{"Cancun", 19426587, 1710338135, 0, "Cancun"},
+	}
+	for _, test := range testList {
+		header := &types.Header{Number: new(big.Int).SetUint64(test.number), Time: test.time, Difficulty: big.NewInt(test.difficulty)}
+		forkList := headerForks(config, header)
+		if got := forkList[len(forkList)-1]; got != test.want {
+			t.Errorf("%s: headerForks = %v, want last %s", test.name, forkList, test.want)
+		}
+	}
+}
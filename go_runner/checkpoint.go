@@ -0,0 +1,130 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件为执行一组区块的命令保存检查点（已经完成的区块以及中间的累计结果），程序中断后可以用 -resume 继续执行
+//检查点在每个区块完成后写入，先写临时文件再重命名，保证中途崩溃时文件不会损坏
+//--------------------------------------------------------------------------------------
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// 检查点
+type Checkpoint struct {
+	Command         string          `json:"command"`          //生成检查点的命令，防止用错检查点
+	CompletedBlocks []uint64        `json:"completed_blocks"` //已经完成的区块
+	Aggregates      json.RawMessage `json:"aggregates"`       //命令自己的累计结果
+
+	path      string
+	completed map[uint64]bool
+}
+
+// 默认的检查点文件
+func checkpointPath(command string) string {
+	return "./output/" + command + ".checkpoint.json"
+}
+
+// 给子命令添加 -checkpoint 和 -resume 参数，解析参数之后调用返回的函数打开检查点
+func checkpointFlags(flagSet *flag.FlagSet, command string) func() (*Checkpoint, error) {
+	path := flagSet.String("checkpoint", checkpointPath(command), "checkpoint file")
+	resume := flagSet.Bool("resume", false, "skip the blocks completed in the checkpoint file")
+	return func() (*Checkpoint, error) {
+		return LoadCheckpoint(*path, command, *resume)
+	}
+}
+
+// 打开检查点，resume 为 false 时新建一个空的检查点（覆盖旧的检查点）
+func LoadCheckpoint(path string, command string, resume bool) (*Checkpoint, error) {
+	c := &Checkpoint{Command: command, path: path, completed: make(map[uint64]bool)}
+	if !resume {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) { //没有检查点则从头开始
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %v", path, err)
+	}
+	if c.Command != command {
+		return nil, fmt.Errorf("checkpoint %s belongs to command %q, not %q", path, c.Command, command)
+	}
+	for _, blockNumber := range c.CompletedBlocks {
+		c.completed[blockNumber] = true
+	}
+	return c, nil
+}
+
+// 是否从检查点继续执行（检查点中已经有完成的区块）
+// Checkpoint 的方法都可以在 nil 上调用，此时不保存检查点
+func (c *Checkpoint) Resumed() bool {
+	return c != nil && len(c.CompletedBlocks) > 0
+}
+
+// 区块是否已经完成
+func (c *Checkpoint) Done(blockNumber uint64) bool {
+	return c != nil && c.completed[blockNumber]
+}
+
+// 去掉区块列表中已经完成的区块
+func (c *Checkpoint) Remaining(blockList []uint64) []uint64 {
+	if c == nil {
+		return blockList
+	}
+	remaining := []uint64{}
+	for _, blockNumber := range blockList {
+		if !c.Done(blockNumber) {
+			remaining = append(remaining, blockNumber)
+		}
+	}
+	return remaining
+}
+
+// 读取累计结果，检查点中没有累计结果时 v 保持不变
+func (c *Checkpoint) LoadAggregates(v interface{}) error {
+	if c == nil || len(c.Aggregates) == 0 {
+		return nil
+	}
+	return json.Unmarshal(c.Aggregates, v)
+}
+
+// 记录一个完成的区块以及当前的累计结果，并写入文件
+func (c *Checkpoint) Save(blockNumber uint64, aggregates interface{}) error {
+	if c == nil {
+		return nil
+	}
+	if !c.completed[blockNumber] {
+		c.completed[blockNumber] = true
+		c.CompletedBlocks = append(c.CompletedBlocks, blockNumber)
+	}
+	data, err := json.Marshal(aggregates)
+	if err != nil {
+		return err
+	}
+	c.Aggregates = data
+
+	data, err = json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmpPath := c.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, c.path)
+}
+
+// 打开输出文件：从检查点继续执行时追加写入，否则新建
+func openOutputFile(path string, resumed bool) (*os.File, error) {
+	if resumed {
+		return os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	}
+	return os.Create(path)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "speedup.checkpoint.json")
+	type aggregates struct {
+		SpeedupList []float64
+		Excluded    map[string]string
+	}
+
+	c, err := LoadCheckpoint(path, "speedup", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Resumed() {
+		t.Error("new checkpoint should not be resumed")
+	}
+	saved := aggregates{SpeedupList: []float64{1.5}, Excluded: map[string]string{}}
+	if err := c.Save(100, &saved); err != nil {
+		t.Fatal(err)
+	}
+	saved.SpeedupList = append(saved.SpeedupList, 2.5)
+	saved.Excluded["102"] = "state_missing"
+	if err := c.Save(102, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Save(102, &saved); err != nil { //重复保存同一个区块
+		t.Fatal(err)
+	}
+
+	resumed, err := LoadCheckpoint(path, "speedup", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resumed.Resumed() {
+		t.Error("loaded checkpoint should be resumed")
+	}
+	if want := []uint64{100, 102}; !reflect.DeepEqual(resumed.CompletedBlocks, want) {
+		t.Errorf("completed blocks = %v, want %v", resumed.CompletedBlocks, want)
+	}
+	if got, want := resumed.Remaining([]uint64{100, 101, 102, 103}), []uint64{101, 103}; !reflect.DeepEqual(got, want) {
+		t.Errorf("remaining = %v, want %v", got, want)
+	}
+	var loaded aggregates
+	if err := resumed.LoadAggregates(&loaded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, saved) {
+		t.Errorf("aggregates = %+v, want %+v", loaded, saved)
+	}
+}
+
+func TestCheckpointWrongCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	c, _ := LoadCheckpoint(path, "speedup", false)
+	if err := c.Save(1, struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCheckpoint(path, "dag", true); err == nil {
+		t.Error("loading another command's checkpoint should fail")
+	}
+}
+
+func TestCheckpointMissingAndNil(t *testing.T) {
+	c, err := LoadCheckpoint(filepath.Join(t.TempDir(), "missing.json"), "speedup", true)
+	if err != nil || c.Resumed() {
+		t.Errorf("missing checkpoint: resumed = %v err = %v, want a new checkpoint", c.Resumed(), err)
+	}
+
+	var nilCheckpoint *Checkpoint
+	if nilCheckpoint.Resumed() || nilCheckpoint.Done(1) {
+		t.Error("nil checkpoint should have no completed blocks")
+	}
+	if got := nilCheckpoint.Remaining([]uint64{1, 2}); !reflect.DeepEqual(got, []uint64{1, 2}) {
+		t.Errorf("nil checkpoint remaining = %v", got)
+	}
+	if err := nilCheckpoint.Save(1, struct{}{}); err != nil {
+		t.Errorf("nil checkpoint save: %v", err)
+	}
+	value := 7
+	if err := nilCheckpoint.LoadAggregates(&value); err != nil || value != 7 {
+		t.Errorf("nil checkpoint aggregates changed the value: %d %v", value, err)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件对 BuildDependencyGraph 返回的 Transaction 和 Account 的关系图做连通分量（冲突簇）分析
+//同一个连通分量中的 Transaction 之间存在直接或间接的冲突，只能串行执行
+//冲突的判断与 access_set.go 的 isConflict 相同：两笔交易访问同一个 Account 且至少一方写（或创建），只读同一个 Account 不冲突
+//执行失败的区块也输出一行，只有 block_number 和 excluded_reason（原因与 speedup 相同，见 process.go）
+//运行方式: go run . cluster [-blocks block_range.csv] [-out ./output/ClusterAnalysis.csv]
+//默认使用 access_set.go 的读写集合建图（存储地址、回滚、预编译合约和账户级读操作都按本地的规则处理）
+//-local=false 使用插桩 geth 的 BuildDependencyGraph，对合约自身的读写记在代码地址上（不区分 DELEGATECALL 的存储地址），只用于对比
+//--------------------------------------------------------------------------------------
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/parallel"
+)
+
+// 一个区块的冲突簇分析结果
+type ClusterResult struct {
+	BlockNumber      uint64
+	TxCount          int
+	ClusterCount     int         //连通分量的数量
+	LargestCluster   int         //最大冲突簇中 Transaction 的数量
+	LargestGasShare  float64     //最大冲突簇消耗的 gas 占区块 gas 的比例（按 gas 选出的最大簇）
+	IndependentRatio float64     //完全独立（不与任何 Transaction 冲突）的 Transaction 的比例
+	SizeDistribution map[int]int //冲突簇大小 -> 该大小的冲突簇数量
+}
+
+// 并查集，用于求连通分量
+type unionFind struct {
+	parent []int
+}
+
+func newUnionFind(n int) *unionFind {
+	u := &unionFind{parent: make([]int, n)}
+	for i := range u.parent {
+		u.parent[i] = i
+	}
+	return u
+}
+
+func (u *unionFind) find(x int) int {
+	for u.parent[x] != x {
+		u.parent[x] = u.parent[u.parent[x]] //路径压缩
+		x = u.parent[x]
+	}
+	return x
+}
+
+func (u *unionFind) union(a int, b int) {
+	ra, rb := u.find(a), u.find(b)
+	if ra != rb {
+		u.parent[rb] = ra
+	}
+}
+
+// 求关系图中 Transaction 的连通分量，返回每笔交易所在分量的编号（分量的代表）
+// 有交易写（或创建）的 Account，所有访问它的 Transaction 都与写者冲突，属于同一个连通分量；只被读的 Account 不合并
+func TxComponents(g *parallel.Graph) []int {
+	setList := AccessSetsFromGraph(g) //边的标签按读写转换，与 EstimateSpeedUp 使用相同的冲突判断
+	txCnt := len(setList)
+	u := newUnionFind(txCnt)
+
+	//按 Account 第一次被访问的顺序记录访问它的 Transaction 以及是否有写者，保证分量的代表稳定
+	accountOrder := []string{}
+	accountTxList := make(map[string][]int)
+	accountWritten := make(map[string]bool)
+	for i, set := range setList {
+		for addr, access := range set.Accounts {
+			if _, ok := accountTxList[addr]; !ok {
+				accountOrder = append(accountOrder, addr)
+			}
+			accountTxList[addr] = append(accountTxList[addr], i)
+			accountWritten[addr] = accountWritten[addr] || access.Write || access.Create
+		}
+	}
+	for _, addr := range accountOrder {
+		if !accountWritten[addr] {
+			continue
+		}
+		txList := accountTxList[addr]
+		for _, txID := range txList[1:] {
+			u.union(txList[0], txID)
+		}
+	}
+
+	component := make([]int, txCnt)
+	for i := range component {
+		component[i] = u.find(i)
+	}
+	return component
+}
+
+// 对一个区块的关系图做冲突簇分析，receipts 用于获得每笔交易消耗的 gas
+func AnalyseClusters(blockNumber uint64, g *parallel.Graph, receipts types.Receipts) ClusterResult {
+	result := ClusterResult{BlockNumber: blockNumber, TxCount: len(g.TxNodeList), SizeDistribution: make(map[int]int)}
+	if result.TxCount == 0 {
+		return result
+	}
+
+	component := TxComponents(g)
+	weights := gasWeights(receipts)
+
+	clusterSize := make(map[int]int)
+	clusterGas := make(map[int]uint64)
+	var blockGas uint64 = 0
+	for i, c := range component {
+		clusterSize[c]++
+		if i < len(weights) {
+			clusterGas[c] += weights[i]
+			blockGas += weights[i]
+		}
+	}
+
+	independentCnt := 0
+	var largestGas uint64 = 0
+	for c, size := range clusterSize {
+		result.SizeDistribution[size]++
+		if size > result.LargestCluster {
+			result.LargestCluster = size
+		}
+		if size == 1 {
+			independentCnt++
+		}
+		if clusterGas[c] > largestGas {
+			largestGas = clusterGas[c]
+		}
+	}
+	result.ClusterCount = len(clusterSize)
+	result.IndependentRatio = float64(independentCnt) / float64(result.TxCount)
+	if blockGas > 0 {
+		result.LargestGasShare = float64(largestGas) / float64(blockGas)
+	}
+	return result
+}
+
+// 冲突簇大小分布的文本格式，例如 "1:30 2:4 5:1"
+func formatDistribution(distribution map[int]int) string {
+	sizeList := make([]int, 0, len(distribution))
+	for size := range distribution {
+		sizeList = append(sizeList, size)
+	}
+	sort.Ints(sizeList)
+	ret := ""
+	for i, size := range sizeList {
+		if i > 0 {
+			ret += " "
+		}
+		ret += fmt.Sprintf("%d:%d", size, distribution[size])
+	}
+	return ret
+}
+
+// CSV 的表头
+var clusterCSVHeader []string = []string{"block_number", "tx_count", "cluster_count", "largest_cluster", "largest_cluster_gas_share", "independent_tx_ratio", "cluster_size_distribution", "excluded_reason"}
+
+// 转换为 CSV 的一行
+func (r ClusterResult) toCSV() []string {
+	return []string{
+		strconv.FormatUint(r.BlockNumber, 10),
+		strconv.Itoa(r.TxCount),
+		strconv.Itoa(r.ClusterCount),
+		strconv.Itoa(r.LargestCluster),
+		strconv.FormatFloat(r.LargestGasShare, 'f', 6, 64),
+		strconv.FormatFloat(r.IndependentRatio, 'f', 6, 64),
+		formatDistribution(r.SizeDistribution),
+		"",
+	}
+}
+
+// 执行失败的区块的一行，只有块号和原因
+func excludedClusterCSV(blockNumber uint64, reason string) []string {
+	record := make([]string, len(clusterCSVHeader))
+	record[0] = strconv.FormatUint(blockNumber, 10)
+	record[len(record)-1] = reason
+	return record
+}
+
+// cluster 子命令：对 -blocks 指定的每个区块做冲突簇分析，逐块输出到 CSV
+func ClusterCommand(args []string) {
+	flagSet := flag.NewFlagSet("cluster", flag.ExitOnError)
+	blockSpec := flagSet.String("blocks", "block_range.csv", "block set, see block_set.go")
+	outFile := flagSet.String("out", "./output/ClusterAnalysis.csv", "output CSV file")
+	local := flagSet.Bool("local", true, "build the graph from access_set.go; false uses parallel.BuildDependencyGraph, which attributes DELEGATECALL storage to the code address")
+	coinbase := flagSet.Bool("coinbase", false, "with -local, count the fee payment to coinbase as a conflict")
+	sender := flagSet.Bool("sender", true, "with -local, count the sender nonce and fee deduction as a conflict")
+	openCheckpoint := checkpointFlags(flagSet, "cluster")
+	progressFlags(flagSet)
+	validateFlags(flagSet)
+	callContextFlags(flagSet)
+	chainFlags(flagSet)
+	logFlags(flagSet)
+	flagSet.Parse(args)
+	traceCallContext = traceCallContext && *local //只有 -local 使用读写集合
+
+	blockList, err := loadBlockSet(*blockSpec)
+	if err != nil {
+		logger.Error("parse block set fail", "err", err)
+		return
+	}
+
+	checkpoint, err := openCheckpoint()
+	if err != nil {
+		logger.Error("open checkpoint fail", "err", err)
+		return
+	}
+
+	writeFile, err := openOutputFile(*outFile, checkpoint.Resumed())
+	if err != nil {
+		logger.Error("open output file fail", "err", err)
+		return
+	}
+	defer writeFile.Close()
+	csvWriter := csv.NewWriter(writeFile)
+	defer csvWriter.Flush()
+	if !checkpoint.Resumed() { //从检查点继续执行时表头已经写过了
+		csvWriter.Write(clusterCSVHeader)
+	}
+
+	remaining := checkpoint.Remaining(blockList)
+	progress := NewProgress(len(remaining))
+	for _, blockNumber := range remaining {
+		block, receipts, err := DoProcess(blockNumber)
+		if err != nil {
+			csvWriter.Write(excludedClusterCSV(blockNumber, errorReason(err)))
+			csvWriter.Flush()
+			if err := checkpoint.Save(blockNumber, nil); err != nil {
+				logger.Warn("save checkpoint fail", "block", blockNumber, "err", err)
+			}
+			progress.Add(0, true)
+			continue
+		}
+
+		var graph *parallel.Graph
+		if *local {
+			graph = BuildModelDependencyGraph(parallel.GetBlockInfo(), block.Coinbase(), ConflictModel{IncludeCoinbase: *coinbase, IncludeSender: *sender})
+		} else {
+			graph = parallel.BuildDependencyGraph()
+		}
+
+		result := AnalyseClusters(blockNumber, graph, receipts)
+		csvWriter.Write(result.toCSV())
+		csvWriter.Flush()
+
+		if err := checkpoint.Save(blockNumber, nil); err != nil {
+			logger.Warn("save checkpoint fail", "block", blockNumber, "err", err)
+		}
+		progress.Add(block.GasUsed(), false)
+	}
+}
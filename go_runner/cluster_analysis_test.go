@@ -0,0 +1,120 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/parallel"
+)
+
+// 构造 txCnt 笔交易的关系图，edgeList 中每一项为 {交易编号, 账户}，默认为写，{交易编号, 账户, 标签} 指定边的标签
+func testRelationGraph(txCnt int, edgeList [][]string) *parallel.Graph {
+	g := &parallel.Graph{}
+	for i := 0; i < txCnt; i++ {
+		g.TxNodeList = append(g.TxNodeList, parallel.TxNode{ID: i})
+	}
+	for _, edge := range edgeList {
+		op := "Write"
+		if len(edge) > 2 {
+			op = edge[2]
+		}
+		g.EdgeList = append(g.EdgeList, parallel.Edge{From: edge[0], To: edge[1], Op: op})
+	}
+	return g
+}
+
+func TestUnionFind(t *testing.T) {
+	u := newUnionFind(6)
+	u.union(0, 1)
+	u.union(2, 3)
+	u.union(1, 3)
+	u.union(4, 4)
+	for _, pair := range [][2]int{{0, 1}, {0, 2}, {0, 3}, {1, 2}} {
+		if u.find(pair[0]) != u.find(pair[1]) {
+			t.Errorf("%d and %d should be in the same set", pair[0], pair[1])
+		}
+	}
+	for _, pair := range [][2]int{{0, 4}, {0, 5}, {4, 5}} {
+		if u.find(pair[0]) == u.find(pair[1]) {
+			t.Errorf("%d and %d should be in different sets", pair[0], pair[1])
+		}
+	}
+}
+
+func TestTxComponents(t *testing.T) {
+	testList := []struct {
+		name     string
+		txCnt    int
+		edgeList [][]string
+		want     []int
+	}{
+		{"no edges", 3, nil, []int{0, 1, 2}},
+		{"shared account", 3, [][]string{{"0", "A"}, {"2", "A"}}, []int{0, 1, 0}},
+		{"transitive", 4, [][]string{{"0", "A"}, {"1", "A"}, {"1", "B"}, {"3", "B"}}, []int{0, 0, 2, 0}},
+		{"two clusters", 4, [][]string{{"0", "A"}, {"2", "A"}, {"1", "B"}, {"3", "B"}}, []int{0, 1, 0, 1}},
+		{"invalid tx id ignored", 2, [][]string{{"0", "A"}, {"x", "A"}, {"5", "A"}}, []int{0, 1}},
+		{"read read", 3, [][]string{{"0", "A", "Read"}, {"1", "A", "Read"}, {"2", "A", "Read"}}, []int{0, 1, 2}},
+		{"readers joined by writer", 3, [][]string{{"0", "A", "Read"}, {"1", "A", "Read"}, {"2", "A", "Write"}}, []int{0, 0, 0}},
+		{"write and read", 2, [][]string{{"0", "A", "Read & Write"}, {"1", "A", "Read"}}, []int{0, 0}},
+		{"create", 2, [][]string{{"0", "A", "Create"}, {"1", "A", "Read"}}, []int{0, 0}},
+		{"read read on one account, write on another", 3, [][]string{{"0", "A", "Read"}, {"1", "A", "Read"}, {"1", "B"}, {"2", "B"}}, []int{0, 1, 1}},
+	}
+	for _, test := range testList {
+		component := TxComponents(testRelationGraph(test.txCnt, test.edgeList))
+		//编号为分量的代表，只比较分组是否相同
+		group := make(map[int]int)
+		got := make([]int, len(component))
+		for i, c := range component {
+			if _, ok := group[c]; !ok {
+				group[c] = i
+			}
+			got[i] = group[c]
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: components = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestAnalyseClusters(t *testing.T) {
+	g := testRelationGraph(4, [][]string{{"0", "A"}, {"1", "A"}, {"1", "B"}})
+	result := AnalyseClusters(1, g, nil)
+	if result.ClusterCount != 3 || result.LargestCluster != 2 {
+		t.Errorf("clusters = %d largest = %d, want 3 and 2", result.ClusterCount, result.LargestCluster)
+	}
+	if want := map[int]int{1: 2, 2: 1}; !reflect.DeepEqual(result.SizeDistribution, want) {
+		t.Errorf("size distribution = %v, want %v", result.SizeDistribution, want)
+	}
+	if result.IndependentRatio != 0.5 {
+		t.Errorf("independent ratio = %v, want 0.5", result.IndependentRatio)
+	}
+	if empty := AnalyseClusters(2, testRelationGraph(0, nil), nil); empty.ClusterCount != 0 {
+		t.Errorf("empty block: clusters = %d, want 0", empty.ClusterCount)
+	}
+}
+
+func TestAnalyseClustersReadOnly(t *testing.T) {
+	//只读同一个合约的交易互不冲突，全部独立
+	g := testRelationGraph(3, [][]string{{"0", "A", "Read"}, {"1", "A", "Read"}, {"2", "A", "Read"}})
+	result := AnalyseClusters(1, g, types.Receipts{{GasUsed: 10}, {GasUsed: 30}, {GasUsed: 60}})
+	if result.ClusterCount != 3 || result.LargestCluster != 1 || result.IndependentRatio != 1 {
+		t.Errorf("read-only block: %+v", result)
+	}
+	if result.LargestGasShare != 0.6 {
+		t.Errorf("largest gas share = %v, want 0.6", result.LargestGasShare)
+	}
+	if speedup := EstimateSpeedUp(AccessSetsFromGraph(g), []uint64{10, 30, 60}); speedup != 100.0/60 {
+		t.Errorf("speedup = %v, want %v", speedup, 100.0/60)
+	}
+}
+
+func TestExcludedClusterCSV(t *testing.T) {
+	record := excludedClusterCSV(9833300, reasonStateMissing)
+	if len(record) != len(clusterCSVHeader) || record[0] != "9833300" || record[len(record)-1] != reasonStateMissing {
+		t.Errorf("excluded row = %v", record)
+	}
+	if record := (ClusterResult{BlockNumber: 1}).toCSV(); len(record) != len(clusterCSVHeader) {
+		t.Errorf("result row has %d columns, want %d", len(record), len(clusterCSVHeader))
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件维护命令行子命令, 运行方式: go run . <子命令> [参数]
+//不带子命令运行时仍然执行 main 函数中默认的流程
+//--------------------------------------------------------------------------------------
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// 子命令名称到运行函数的映射, 运行函数接收子命令之后的参数
+var commandMap map[string]func(args []string) = map[string]func(args []string){
+	"cluster":          ClusterCommand,
+	"compare":          CompareCommand,
+	"conflict-speedup": ConflictSpeedUpCommand,
+	"dag":              DAGCommand,
+	"replay":           ReplayCommand,
+	"replay-tx":        ReplayTxCommand,
+	"report":           ReportCommand,
+	"select-blocks":    SelectBlocksCommand,
+	"speedup":          SpeedUpCommand,
+}
+
+// 运行子命令
+func runCommand(name string, args []string) {
+	command, ok := commandMap[name]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "Unknown command:", name)
+		printUsage()
+		os.Exit(2)
+	}
+	command(args)
+}
+
+// 打印所有子命令
+func printUsage() {
+	nameList := make([]string, 0, len(commandMap))
+	for name := range commandMap {
+		nameList = append(nameList, name)
+	}
+	sort.Strings(nameList)
+	fmt.Fprintln(os.Stderr, "Usage: go run . <command> [flags]")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, name := range nameList {
+		fmt.Fprintln(os.Stderr, "\t"+name)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件定义 On-CPU/Off-CPU 分析报告，文本格式与 rust_runner/data/report.txt 相同，方便比较 geth 和 reth 执行同一组区块
+//	Elapsed Time / On-CPU Time / Off-CPU Time
+//	Ranking On-CPU（按函数自身时间排序）、On-CPU Icicle（火焰图的叶子帧）、Off-CPU Icicle（阻塞位置）各取前 5 个
+//--------------------------------------------------------------------------------------
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// 报告中每个列表保留的条数
+const reportTopN = 5
+
+// 一个函数（或调用栈帧）占用的时间
+type FrameShare struct {
+	Name    string  `json:"name"`
+	Seconds float64 `json:"seconds"`
+	Percent float64 `json:"percent"` //占所在列表总时间的百分比
+}
+
+// On-CPU/Off-CPU 分析报告
+type CPUReport struct {
+	ElapsedTime     float64      `json:"elapsed_time"` //单位为秒
+	OnCPUTime       float64      `json:"on_cpu_time"`
+	OffCPUTime      float64      `json:"off_cpu_time"`
+	OnCPURanking    []FrameShare `json:"on_cpu_ranking"`
+	OnCPUIcicle     []FrameShare `json:"on_cpu_icicle"`
+	OffCPUIcicle    []FrameShare `json:"off_cpu_icicle"`
+	OffCPUBreakdown []FrameShare `json:"off_cpu_breakdown,omitempty"` //Off-CPU 时间的来源，report.txt 中没有
+	OffCPUScope     string       `json:"off_cpu_scope,omitempty"`     //Off-CPU 时间的统计范围，为空时与 offcputime -p 相同（整个进程）
+}
+
+// 按时间从大到小取前 n 个，百分比以 total 为基准
+func topFrames(frameTime map[string]float64, total float64, n int) []FrameShare {
+	frameList := make([]FrameShare, 0, len(frameTime))
+	for name, seconds := range frameTime {
+		share := FrameShare{Name: name, Seconds: seconds}
+		if total > 0 {
+			share.Percent = seconds * 100 / total
+		}
+		frameList = append(frameList, share)
+	}
+	sort.Slice(frameList, func(i, j int) bool {
+		if frameList[i].Seconds != frameList[j].Seconds {
+			return frameList[i].Seconds > frameList[j].Seconds
+		}
+		return frameList[i].Name < frameList[j].Name
+	})
+	if len(frameList) > n {
+		frameList = frameList[:n]
+	}
+	return frameList
+}
+
+// 名字列的宽度，与 report.txt 一样至少为 width
+func nameWidth(frameList []FrameShare, width int) int {
+	for _, frame := range frameList {
+		if len(frame.Name) > width {
+			width = len(frame.Name)
+		}
+	}
+	return width
+}
+
+// 输出 report.txt 格式的文本
+func (r *CPUReport) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "Elapsed Time: %.2f seconds\n\n", r.ElapsedTime)
+	fmt.Fprintf(w, "On-CPU Time: %.2f seconds\n", r.OnCPUTime)
+	if r.OffCPUScope != "" {
+		fmt.Fprintf(w, "Off-CPU Time (%s): %.2f seconds\n\n", r.OffCPUScope, r.OffCPUTime)
+	} else {
+		fmt.Fprintf(w, "Off-CPU Time: %.2f seconds\n\n", r.OffCPUTime)
+	}
+
+	fmt.Fprintln(w, "Ranking:")
+	fmt.Fprintln(w, "On-CPU:")
+	width := nameWidth(r.OnCPURanking, 40)
+	for i, frame := range r.OnCPURanking {
+		fmt.Fprintf(w, "%d. %-*s ( %.2f%%, %.2fs )\n", i+1, width, frame.Name, frame.Percent, frame.Seconds)
+	}
+	fmt.Fprint(w, "\n\n")
+
+	fmt.Fprintln(w, "On-CPU Icicle:")
+	width = nameWidth(r.OnCPUIcicle, 40)
+	for i, frame := range r.OnCPUIcicle {
+		fmt.Fprintf(w, "%d. %-*s ( %.2f%% )\n", i+1, width, frame.Name, frame.Percent)
+	}
+	fmt.Fprint(w, "\n\n")
+
+	fmt.Fprintln(w, "Off-CPU Icicle:")
+	width = nameWidth(r.OffCPUIcicle, 64)
+	for i, frame := range r.OffCPUIcicle {
+		fmt.Fprintf(w, "%d. %-*s ( %.2fs, %.2f%% )\n", i+1, width, frame.Name, frame.Seconds, frame.Percent)
+	}
+
+	if len(r.OffCPUBreakdown) > 0 {
+		fmt.Fprint(w, "\n\n")
+		fmt.Fprintln(w, "Off-CPU Breakdown:")
+		width = nameWidth(r.OffCPUBreakdown, 40)
+		for i, frame := range r.OffCPUBreakdown {
+			fmt.Fprintf(w, "%d. %-*s ( %.2fs, %.2f%% )\n", i+1, width, frame.Name, frame.Seconds, frame.Percent)
+		}
+	}
+}
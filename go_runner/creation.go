@@ -0,0 +1,138 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件统一处理创建合约的交易
+//Hook 的 TxInfo.To 是字符串，创建合约的交易为 "nil"，其他交易的 NewContractAddr 为零地址
+//这里把它们转换为可以为空的地址：To 为 nil 表示创建合约，NewContractAddr 只在创建合约时不为 nil
+//导出 Hook 数据（txLog.json）、读写集合、调用树和各种图都通过这里判断，不再直接比较 "nil"
+//包含创建合约交易的区块集合: fixtures/creation_blocks.csv，可以用 select-blocks -strategy creation 从本地节点重新生成
+//	go run . replay -blocks fixtures/creation_blocks.csv -validate
+//	go run . dag -blocks fixtures/creation_blocks.csv
+//手工构造的 Hook 数据（不是真实区块）: fixtures/creation_hook.json，包含 init code 记录为零地址、内部 CREATE/CREATE2 等情况，由 creation_test.go 使用
+//--------------------------------------------------------------------------------------
+
+import (
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/parallel"
+)
+
+// 交易的接收者，创建合约的交易返回 nil
+func txTo(tx *parallel.TxInfo) *common.Address {
+	if tx.To == "nil" || tx.To == "" {
+		return nil
+	}
+	to := common.HexToAddress(tx.To)
+	return &to
+}
+
+// 是否为创建合约的交易
+func isContractCreation(tx *parallel.TxInfo) bool {
+	return txTo(tx) == nil
+}
+
+// 创建的合约地址，不是创建合约的交易返回 nil
+func txNewContract(tx *parallel.TxInfo) *common.Address {
+	if !isContractCreation(tx) {
+		return nil
+	}
+	newContract := tx.NewContractAddr
+	return &newContract
+}
+
+// 图和报告中显示的接收者，创建合约的交易显示为 "Create 0x<合约地址>"
+func txToLabel(tx *parallel.TxInfo) string {
+	if newContract := txNewContract(tx); newContract != nil {
+		return "Create " + newContract.Hex()
+	}
+	return txTo(tx).Hex()
+}
+
+// 只有 parallel.TxNode 等只有 To 字符串的地方使用
+func toLabel(to string) string {
+	if to == "nil" || to == "" {
+		return "Create"
+	}
+	return to
+}
+
+// 导出的 Hook 交易信息，字段与 parallel.TxInfo 相同，只是 To 和 NewContractAddr 可以为空（JSON 中为 null 或省略）
+type HookTxInfo struct {
+	TxHash          common.Hash
+	From            common.Address
+	To              *common.Address
+	NewContractAddr *common.Address `json:",omitempty"`
+	Value           *big.Int
+	Fee             *big.Int
+	GasPrice        *big.Int
+	Data            []byte
+	CallQueue       []*parallel.CallInfo
+}
+
+// 导出的 Hook 区块信息
+type HookBlockInfo struct {
+	BlockHash common.Hash
+	GasLimit  uint64
+	Tx        []*HookTxInfo
+}
+
+// 把 Hook 的数据转换为导出格式，执行区块时记录了调用树则把账户级读操作合并到 KeyOpcode 中
+func exportBlockInfo(blockInfo *parallel.BlockInfo) *HookBlockInfo {
+	export := &HookBlockInfo{BlockHash: blockInfo.BlockHash, GasLimit: blockInfo.GasLimit, Tx: make([]*HookTxInfo, 0, len(blockInfo.Tx))}
+	callTrees := blockCallTrees(blockInfo) //有调用树时合并账户级读操作（见 account_read.go）
+	for i, tx := range blockInfo.Tx {
+		callQueue := tx.CallQueue
+		if callTrees != nil {
+			callQueue = exportCallQueue(callTrees[i], tx.CallQueue)
+		}
+		export.Tx = append(export.Tx, &HookTxInfo{
+			TxHash:          tx.TxHash,
+			From:            tx.From,
+			To:              txTo(tx),
+			NewContractAddr: txNewContract(tx),
+			Value:           tx.Value,
+			Fee:             tx.Fee,
+			GasPrice:        tx.GasPrice,
+			Data:            tx.Data,
+			CallQueue:       callQueue,
+		})
+	}
+	return export
+}
+
+// 没有调用树时确定每个 CallQueue 项执行的是哪个合约的构造函数（init code）
+// Hook 为 init code 记录的地址可能为零地址，此时创建合约交易的最外层调用属于新合约，内部的 CREATE/CREATE2 属于 KeyOpcode 中最近创建的地址
+// 返回每个 CallQueue 项的地址，不是 init code 或者已经有地址时为 Hook 记录的 ContractAddr
+func initCodeContexts(tx *parallel.TxInfo) []common.Address {
+	contextList := make([]common.Address, len(tx.CallQueue))
+	if len(tx.CallQueue) == 0 {
+		return contextList
+	}
+	minLayer := tx.CallQueue[0].Layer
+	for _, call := range tx.CallQueue {
+		if call.Layer < minLayer {
+			minLayer = call.Layer
+		}
+	}
+	var lastCreated *common.Address //KeyOpcode 中最近创建的地址
+	for i, call := range tx.CallQueue {
+		contextList[i] = call.ContractAddr
+		if call.ContractAddr == (common.Address{}) {
+			if newContract := txNewContract(tx); newContract != nil && call.Layer == minLayer {
+				contextList[i] = *newContract
+			} else if lastCreated != nil {
+				contextList[i] = *lastCreated
+			}
+		}
+		for _, keyOpcode := range call.KeyOpcode {
+			split := strings.Split(keyOpcode, " ")
+			if len(split) >= 3 && (split[1] == "CREATE" || split[1] == "CREATE2") {
+				created := common.HexToAddress(split[2])
+				lastCreated = &created
+			}
+		}
+	}
+	return contextList
+}
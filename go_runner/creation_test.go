@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/parallel"
+)
+
+// 读取手工构造的 Hook 数据（见 creation.go），包含：
+//
+//	0: 创建工厂合约 0xf01，init code 中 CREATE2 子合约，都记录为零地址
+//	1: 调用交易 0 创建的工厂合约，带转账 CREATE 子合约
+//	2: 创建合约，init code 记录为零地址
+//	3: 带转账的创建合约，init code 记录为新合约地址
+//	4: 交易 3 的发送者的普通转账
+func loadCreationFixture(t *testing.T) *parallel.BlockInfo {
+	t.Helper()
+	data, err := os.ReadFile("fixtures/creation_hook.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockInfo := new(parallel.BlockInfo)
+	if err := json.Unmarshal(data, blockInfo); err != nil {
+		t.Fatal(err)
+	}
+	return blockInfo
+}
+
+func TestCreationTx(t *testing.T) {
+	blockInfo := loadCreationFixture(t)
+	hex := func(addr string) string { return common.HexToAddress(addr).Hex() }
+	testList := []struct {
+		to          string
+		newContract string
+		label       string
+	}{
+		{"", hex("0xf01"), "Create " + hex("0xf01")},
+		{hex("0xf01"), "", hex("0xf01")},
+		{"", hex("0xa01"), "Create " + hex("0xa01")},
+		{"", hex("0xa03"), "Create " + hex("0xa03")},
+		{hex("0xd01"), "", hex("0xd01")},
+	}
+	for i, test := range testList {
+		tx := blockInfo.Tx[i]
+		to, newContract := txTo(tx), txNewContract(tx)
+		if (to == nil) != (test.to == "") || (to != nil && to.Hex() != test.to) {
+			t.Errorf("tx %d: txTo = %v, want %q", i, to, test.to)
+		}
+		if (newContract == nil) != (test.newContract == "") || (newContract != nil && newContract.Hex() != test.newContract) {
+			t.Errorf("tx %d: txNewContract = %v, want %q", i, newContract, test.newContract)
+		}
+		if got := isContractCreation(tx); got != (test.to == "") {
+			t.Errorf("tx %d: isContractCreation = %v", i, got)
+		}
+		if got := txToLabel(tx); got != test.label {
+			t.Errorf("tx %d: txToLabel = %q, want %q", i, got, test.label)
+		}
+	}
+	if got := toLabel("nil"); got != "Create" {
+		t.Errorf("toLabel(nil) = %q", got)
+	}
+}
+
+func TestInitCodeContexts(t *testing.T) {
+	blockInfo := loadCreationFixture(t)
+	addr := common.HexToAddress
+	wantList := [][]common.Address{
+		{addr("0xf01"), addr("0xc01"), addr("0xf01")},
+		{addr("0xf01"), addr("0xc02"), addr("0xf01")},
+		{addr("0xa01")},
+		{addr("0xa03")},
+		{addr("0xd01")},
+	}
+	for i, want := range wantList {
+		if got := initCodeContexts(blockInfo.Tx[i]); !reflect.DeepEqual(got, want) {
+			t.Errorf("tx %d: initCodeContexts = %v, want %v", i, got, want)
+		}
+		//没有调用树时存储地址与 init code 的地址相同
+		if got := storageContexts(nil, blockInfo.Tx[i]); !reflect.DeepEqual(got, want) {
+			t.Errorf("tx %d: storageContexts = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestBuildCallTreeCreation(t *testing.T) {
+	blockInfo := loadCreationFixture(t)
+
+	//创建工厂合约：子调用返回之后的继续执行合并到根，子调用为 CREATE2
+	root := BuildCallTree(blockInfo.Tx[0])
+	if root.Type != "CREATE" || len(root.Children) != 1 || len(root.KeyOpcode) != 3 {
+		t.Fatalf("tx 0: root = %+v", root)
+	}
+	if child := root.Children[0]; child.Type != "CREATE2" || child.Depth != 1 || len(child.KeyOpcode) != 1 {
+		t.Errorf("tx 0: child = %+v", child)
+	}
+
+	//调用工厂合约
+	root = BuildCallTree(blockInfo.Tx[1])
+	if root.Type != "CALL" || root.To != common.HexToAddress("0xf01").Hex() || len(root.Children) != 1 || len(root.KeyOpcode) != 3 {
+		t.Fatalf("tx 1: root = %+v", root)
+	}
+	if child := root.Children[0]; child.Type != "CREATE" || child.From != root.To {
+		t.Errorf("tx 1: child = %+v", child)
+	}
+	if read, write := root.access(); !read || !write {
+		t.Errorf("tx 1: root access = %v, %v", read, write)
+	}
+
+	if root := BuildCallTree(blockInfo.Tx[3]); root.Type != "CREATE" || root.Value != "1000000000000000000" || len(root.Children) != 0 {
+		t.Errorf("tx 3: root = %+v", root)
+	}
+	if BuildCallTree(&parallel.TxInfo{To: "nil"}) != nil {
+		t.Error("empty call queue should not build a call tree")
+	}
+}
+
+func TestBuildAccessSetsCreation(t *testing.T) {
+	blockInfo := loadCreationFixture(t)
+	addr := func(hex string) string { return common.HexToAddress(hex).Hex() }
+	wantList := []map[string]AccountAccess{
+		{addr("0xf01"): {Read: true, Write: true, Create: true}, addr("0xc01"): {Write: true, Create: true}},
+		{addr("0xf01"): {Read: true, Write: true}, addr("0xc02"): {Write: true, Create: true}},
+		{addr("0xa01"): {Read: true, Write: true, Create: true}},
+		{addr("0xa03"): {Write: true, Create: true}, addr("0xe2"): {Read: true, Write: true}}, //带转账的创建合约扣除发送者的余额
+		{addr("0xe2"): {Read: true, Write: true}, addr("0xd01"): {Read: true, Write: true}},
+	}
+	setList := BuildAccessSets(blockInfo, common.Address{}, ConflictModel{})
+	for i, want := range wantList {
+		got := map[string]AccountAccess{}
+		for account, access := range setList[i].Accounts {
+			got[account] = *access
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("tx %d: accounts = %+v, want %+v", i, got, want)
+		}
+	}
+	//调用工厂合约的交易与创建它的交易冲突，带转账的创建合约与同一发送者的转账冲突（不包含发送者 nonce 时也冲突），其余互不冲突
+	for _, pair := range [][2]int{{0, 1}, {3, 4}} {
+		if !isConflict(setList[pair[0]], setList[pair[1]]) {
+			t.Errorf("tx %d and tx %d should conflict", pair[0], pair[1])
+		}
+	}
+	for _, pair := range [][2]int{{0, 2}, {1, 2}, {0, 3}, {2, 3}, {2, 4}} {
+		if isConflict(setList[pair[0]], setList[pair[1]]) {
+			t.Errorf("tx %d and tx %d should not conflict", pair[0], pair[1])
+		}
+	}
+}
+
+// JSON 中的地址（小写的十六进制字符串）
+func jsonAddr(value any) common.Address {
+	hex, _ := value.(string)
+	return common.HexToAddress(hex)
+}
+
+func TestExportBlockInfoCreation(t *testing.T) {
+	export := exportBlockInfo(loadCreationFixture(t))
+	data, err := json.Marshal(export.Tx[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tx map[string]any
+	if err := json.Unmarshal(data, &tx); err != nil {
+		t.Fatal(err)
+	}
+	if tx["To"] != nil || jsonAddr(tx["NewContractAddr"]) != common.HexToAddress("0xf01") {
+		t.Errorf("exported creation tx: To = %v, NewContractAddr = %v", tx["To"], tx["NewContractAddr"])
+	}
+	if data, err = json.Marshal(export.Tx[1]); err != nil {
+		t.Fatal(err)
+	}
+	tx = nil
+	if err := json.Unmarshal(data, &tx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tx["NewContractAddr"]; ok || jsonAddr(tx["To"]) != common.HexToAddress("0xf01") {
+		t.Errorf("exported call tx: %v", tx)
+	}
+}
@@ -1,16 +1,16 @@
+//go:build ignore
+
+// 本文件有自己的 main 函数，需要单独运行: go run db.go block_list.go replayer.go checkpoint.go progress.go validate.go chain.go block_set.go precompile.go cancun.go [-blocks block_range.csv] [-workers N] [-serial] [-resume] [-quiet] [-validate] [-precompiles] [-chain mainnet|sepolia|holesky] [-genesis genesis.json]
 package main
 
 import (
-	"encoding/csv"
+	"bytes"
+	"flag"
 	"fmt"
-	"io"
-	"log"
 	"os"
-	"strconv"
+	"strings"
 	"time"
 
-	"github.com/ethereum/go-ethereum/consensus/ethash"
-	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/vm"
 )
@@ -21,7 +21,13 @@ func check(e error) {
 	}
 }
 
-func ReadTest3() {
+// workers 为并行执行区块的 worker 数量（0 表示使用全部 CPU），serial 为 true 时串行执行
+// 默认串行执行（-workers 1）：Process 在 hookLock 内串行执行，多个 worker 只重叠读取区块和打开状态，却会在计时时争抢 CPU
+// 执行失败的区块不计入 opcode 统计，记在 Failed_blocks 中
+// checkpoint 保存已经完成的区块和 total_op_count、total_op_time 等累计结果，为 nil 时不保存
+// blockSpec 为要执行的区块集合，写法见 block_set.go
+// precompiles 为 true 时用 EVMLogger 统计每个预编译合约的次数、时间和 gas（见 precompile.go），写在每个区块的 opcode 之后
+func ReadTest3(blockSpec string, workers int, serial bool, precompiles bool, checkpoint *Checkpoint) {
 	datadir := "/home/user/common/docker/volumes/cp1_eth-docker_geth-eth1-data/_data/geth/chaindata"
 	// datadir := "/home/user/data/ben/cp1_eth-docker_geth-eth1-data/_data/geth/chaindata"
 	ancient := datadir + "/ancient"
@@ -42,98 +48,230 @@ func ReadTest3() {
 	// bc, _ := core.NewBlockChain(db, core.DefaultCacheConfigWithScheme(rawdb.PathScheme), nil, nil, ethash.NewFaker(), vm.Config{}, nil, nil)
 
 	// datadir: cp1_eth-docker
-	bc, _ := core.NewBlockChain(db, core.DefaultCacheConfigWithScheme(rawdb.HashScheme), nil, nil, ethash.NewFaker(), vm.Config{}, nil, nil)
-	fmt.Println("get bc")
+	// 链配置和共识引擎见 chain.go
+	bc, err := newChain(db)
+	check(err)
+	fmt.Println("get bc", chainLabel())
 
 	// headhash := rawdb.ReadHeadHeaderHash(db)
 	// headnumber_adr := rawdb.ReadHeaderNumber(db, headhash)
 	// headnumber := *headnumber_adr
 
-	total_exec_time := time.Duration(0)
-	total_used_gas := uint64(0)
-	total_op_count := map[string]int64{}
-	total_op_time := map[string]int64{}
+	// 累计结果，保存在检查点中，从检查点继续执行时先恢复
+	totals := struct {
+		Total_exec_time time.Duration    `json:"total_exec_time"`
+		Total_used_gas  uint64           `json:"total_used_gas"`
+		Total_op_count  map[string]int64 `json:"total_op_count"`
+		Total_op_time   map[string]int64 `json:"total_op_time"`
+		Invalid_blocks  []uint64         `json:"invalid_blocks"` // -validate 检查不通过的区块，不计入累计结果
+		Failed_blocks   []uint64         `json:"failed_blocks"`  // 区块或状态读取不到的区块，不计入累计结果
+
+		Total_precompile map[string]*PrecompileStat `json:"total_precompile"` // 按地址累计的预编译合约统计
+	}{0, 0, map[string]int64{}, map[string]int64{}, nil, nil, map[string]*PrecompileStat{}}
+	check(checkpoint.LoadAggregates(&totals))
 
-	f, err := os.Open("block_range.csv")
+	block_list, err := ParseBlockSet(blockSpec, db)
 	check(err)
-	defer f.Close()
 
-	write_file, err := os.Create("op_time_list.csv")
+	write_file, err := openOutputFile("op_time_list.csv", checkpoint.Resumed())
 	check(err)
 	defer write_file.Close()
 
-	csvReader := csv.NewReader(f)
-	for {
-		rec, err := csvReader.Read()
-		if err == io.EOF || rec[0] == "" {
-			break
-		}
-		if err != nil {
-			log.Fatal(err)
-		}
-		headnumber, _ := strconv.ParseUint(rec[0], 10, 64)
+	// 一个区块的执行结果, op_time_list 的内容在 worker 中先写入 op_text
+	type block_result struct {
+		exec_time time.Duration
+		used_gas  uint64
+		op_count  map[string]int64
+		op_time   map[string]int64
+		op_text   bytes.Buffer
+
+		precompiles []PrecompileStat
+		invalid   error // -validate 检查不通过的原因
+		err       error // 区块或状态读取不到
+	}
 
-		fmt.Println("Headnumber is:", headnumber)
+	// 在 worker 中执行一个区块，所有 worker 共用同一个 db 和 bc
+	// 插桩的 Process 会写入全局的 Hook 数据，多个 worker 同时执行会冲突，所以 Process 在 hookLock 内执行，读取区块和状态在锁外进行
+	work := func(headnumber uint64) interface{} {
+		result := &block_result{}
+		if !quiet {
+			fmt.Println("Headnumber is:", headnumber)
+		}
 		parentnumber := headnumber - 1
 		hashtest := rawdb.ReadCanonicalHash(db, headnumber)
 		parenthash := rawdb.ReadCanonicalHash(db, parentnumber)
 		block := rawdb.ReadBlock(db, hashtest, headnumber)
 
 		if block == nil {
-			log.Fatal("Failed to retrieve the latest block header")
+			result.err = fmt.Errorf("failed to retrieve block %d", headnumber)
+			return result
 		}
 		parentblock := rawdb.ReadBlock(db, parenthash, parentnumber)
 		if parentblock == nil {
-			log.Fatal("Failed to retrieve the latest block header")
+			result.err = fmt.Errorf("failed to retrieve parent block %d", parentnumber)
+			return result
 		}
 
 		parentRoot := parentblock.Root()
-		statedb, _ := bc.StateAt(parentRoot)
-		if statedb == nil {
-			log.Fatal("Failed to retrieve the statedb of parentRoot")
+		statedb, err := bc.StateAt(parentRoot)
+		if err != nil {
+			result.err = fmt.Errorf("failed to retrieve the statedb of parentRoot: %v", err)
+			return result
+		}
+
+		if !quiet {
+			fmt.Println("Active forks:", strings.Join(headerForks(bc.Config(), block.Header()), ","))
+		}
+
+		vmConfig := vm.Config{}
+		var tracer *precompileTracer
+		if precompiles {
+			tracer = newPrecompileTracer()
+			vmConfig.Tracer = tracer
 		}
 
+		hookLock.Lock()
 		startTime := time.Now()
-		_, _, usedGas, _, op_count, op_time, op_time_list, op_gas_list := bc.Processor().Process(block, statedb, vm.Config{})
+		receipts, _, usedGas, err, op_count, op_time, op_time_list, op_gas_list := bc.Processor().Process(block, statedb, vmConfig)
 		elapsedTime := time.Since(startTime)
+		hookLock.Unlock()
+		if err != nil { // 执行失败的区块不计入 opcode 统计
+			result.err = fmt.Errorf("failed to process block %d: %v", headnumber, err)
+			return result
+		}
 
 		trieRead := statedb.SnapshotAccountReads + statedb.AccountReads // The time spent on account read
 		trieRead += statedb.SnapshotStorageReads + statedb.StorageReads // The time spent on storage read
 		exec_time := elapsedTime - trieRead                             // The time spent on EVM processing
 
-		fmt.Println("elapsedTime", elapsedTime)
-		fmt.Println("exec time", exec_time)
-		fmt.Println("usedGas", usedGas)
+		if !quiet {
+			fmt.Println("elapsedTime", elapsedTime)
+			fmt.Println("exec time", exec_time)
+			fmt.Println("usedGas", usedGas)
+
+			fmt.Println("db output op count", op_count)
+			fmt.Println("db output op time", op_time)
+		}
 
-		fmt.Println("db output op count", op_count)
-		fmt.Println("db output op time", op_time)
+		// 检查执行结果是否与区块头一致，在计时之后进行
+		if validateReplay {
+			result.invalid = validateExecution(bc.Config(), block, statedb, receipts, usedGas)
+			if result.invalid != nil {
+				fmt.Println("Validation fail", headnumber, result.invalid)
+			}
+		}
 
-		fmt.Fprintln(write_file, "Headnumber:", headnumber)
+		fmt.Fprintln(&result.op_text, "Headnumber:", headnumber)
 		for op_code, time_value := range op_time_list {
-			fmt.Fprintln(write_file, "OpCode:", op_code)
-			fmt.Fprintln(write_file, "Time Used:", time_value)
-			fmt.Fprintln(write_file, "Gas Used:", op_gas_list[op_code])
+			fmt.Fprintln(&result.op_text, "OpCode:", op_code)
+			fmt.Fprintln(&result.op_text, "Time Used:", time_value)
+			fmt.Fprintln(&result.op_text, "Gas Used:", op_gas_list[op_code])
+		}
+		// 预编译合约的时间也算在调用它的 CALL 等 opcode 中
+		if tracer != nil {
+			result.precompiles = tracer.stats()
+		}
+		// 按类别汇总（见 cancun.go），transient storage（TLOAD/TSTORE）不与 SLOAD/SSTORE 混在一起
+		for _, category := range opcodeCategoryTotals(op_count, op_time) {
+			fmt.Fprintln(&result.op_text, "Category:", category.Category)
+			fmt.Fprintln(&result.op_text, "Count:", category.Count)
+			fmt.Fprintln(&result.op_text, "Time Used:", category.TimeNs)
+		}
+		for _, stat := range result.precompiles {
+			fmt.Fprintln(&result.op_text, "Precompile:", stat.Name)
+			fmt.Fprintln(&result.op_text, "Count:", stat.Count)
+			fmt.Fprintln(&result.op_text, "Time Used:", stat.TimeNs)
+			fmt.Fprintln(&result.op_text, "Gas Used:", stat.Gas)
+		}
+		fmt.Fprintln(&result.op_text, "")
 
-			total_op_count[op_code] += op_count[op_code]
-			total_op_time[op_code] += op_time[op_code]
+		result.exec_time = exec_time
+		result.used_gas = usedGas
+		result.op_count = op_count
+		result.op_time = op_time
+		return result
+	}
+
+	remaining := checkpoint.Remaining(block_list)
+	progress := NewProgress(len(remaining))
+
+	// 按区块顺序写文件并累加
+	emit := func(index int, headnumber uint64, res interface{}) {
+		result := res.(*block_result)
+		if result.err != nil {
+			fmt.Println("Replay fail", headnumber, result.err)
+			fmt.Fprintln(write_file, "Headnumber:", headnumber)
+			fmt.Fprintln(write_file, "Replay Fail:", result.err)
+			fmt.Fprintln(write_file, "")
+			totals.Failed_blocks = append(totals.Failed_blocks, headnumber)
+			check(checkpoint.Save(headnumber, &totals))
+			progress.Add(0, true)
+			return
+		}
+		if result.invalid != nil {
+			fmt.Fprintln(write_file, "Headnumber:", headnumber)
+			fmt.Fprintln(write_file, "Validation Fail:", result.invalid)
+			fmt.Fprintln(write_file, "")
+			totals.Invalid_blocks = append(totals.Invalid_blocks, headnumber)
+			check(checkpoint.Save(headnumber, &totals))
+			progress.Add(result.used_gas, true)
+			return
+		}
+		write_file.Write(result.op_text.Bytes())
+		for op_code := range result.op_time {
+			totals.Total_op_count[op_code] += result.op_count[op_code]
+			totals.Total_op_time[op_code] += result.op_time[op_code]
 		}
-		fmt.Fprintln(write_file, "")
+		addPrecompileStats(totals.Total_precompile, result.precompiles)
 
-		total_exec_time += exec_time
-		total_used_gas += usedGas
+		totals.Total_exec_time += result.exec_time
+		totals.Total_used_gas += result.used_gas
+
+		// 每个区块完成后保存检查点
+		check(checkpoint.Save(headnumber, &totals))
+		progress.Add(result.used_gas, false)
 	}
 
-	fmt.Println("Total Exec Time:", total_exec_time)
-	fmt.Println("Total Used Gas:", total_used_gas)
+	NewRangeReplayer(workers, serial).Run(remaining, work, emit)
+
+	fmt.Println("Total Exec Time:", totals.Total_exec_time)
+	fmt.Println("Total Used Gas:", totals.Total_used_gas)
+	if validateReplay {
+		fmt.Println("Invalid Blocks:", totals.Invalid_blocks)
+	}
+	if len(totals.Failed_blocks) > 0 {
+		fmt.Println("Failed Blocks:", totals.Failed_blocks)
+	}
 
 	total_average_list := map[string]int64{}
-	for op_code, time_value := range total_op_time {
-		count := total_op_count[op_code]
+	for op_code, time_value := range totals.Total_op_time {
+		count := totals.Total_op_count[op_code]
 		total_average_list[op_code] = time_value / count
 	}
 	fmt.Println("Average Time Used of OpCode:", total_average_list)
+
+	fmt.Println("OpCode Categories:")
+	for _, category := range opcodeCategoryTotals(totals.Total_op_count, totals.Total_op_time) {
+		fmt.Printf("\t%-16s count: %-10d time: %d\n", category.Category, category.Count, category.TimeNs)
+	}
+
+	if len(totals.Total_precompile) > 0 {
+		fmt.Println("Precompiles:")
+		writePrecompileStats(os.Stdout, sortedPrecompileStats(totals.Total_precompile))
+	}
 }
 
 func main() {
-	ReadTest3()
+	blockSpec := flag.String("blocks", "block_range.csv", "block set, see block_set.go")
+	workers := flag.Int("workers", 1, "number of workers, 0 means all CPUs; blocks still execute one at a time under hookLock, see replayer.go")
+	serial := flag.Bool("serial", false, "replay blocks one by one, for timing-sensitive runs")
+	precompiles := flag.Bool("precompiles", true, "count time and gas of each precompile with an EVMLogger, which slightly inflates opcode times; set false for timing-only runs")
+	openCheckpoint := checkpointFlags(flag.CommandLine, "read_test3")
+	progressFlags(flag.CommandLine)
+	validateFlags(flag.CommandLine)
+	chainFlags(flag.CommandLine)
+	flag.Parse()
+	checkpoint, err := openCheckpoint()
+	check(err)
+	ReadTest3(*blockSpec, *workers, *serial, *precompiles, checkpoint)
 }
@@ -8,8 +8,8 @@ package main
 import (
 	"fmt"
 	"strconv"
-	"strings"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/parallel"
 )
 
@@ -57,9 +57,11 @@ func addEdge(from string, to string, lineType string, label string, color string
 }
 
 // 绘图方法
-func GetGraphDemo(path string, fileName string) {
+// coinbase 为区块的手续费接收者，model 决定是否画出手续费和发送者 nonce 导致的读写
+func GetGraphDemo(path string, fileName string, coinbase common.Address, model ConflictModel) {
 
-	blockInfo := parallel.GetBlockInfo() //获取 blockInfo 对象
+	blockInfo := parallel.GetBlockInfo()                   //获取 blockInfo 对象
+	setList := BuildAccessSets(blockInfo, coinbase, model) //每笔交易的读写集合
 
 	//	新建一张图并初始化
 	graph := Graph{GraphName: "G"}
@@ -95,7 +97,7 @@ func GetGraphDemo(path string, fileName string) {
 		//设置 From To Value的cell
 		row2 := TableRow{}
 		from := tx.From.Hex()
-		to := tx.To
+		to := txToLabel(tx)
 		value := tx.Value.String()
 
 		txInfoCell := TableCell{Content: "<b>From: </b>" + from + "<br/>" + "<b>To: </b>" + to + "<br/><b>Value: </b>" + value}
@@ -111,130 +113,20 @@ func GetGraphDemo(path string, fileName string) {
 		node.AddAttr("label", txTable.toString())
 		graph.AddNode(node)
 
-		//接下来开始画调用依赖
-		//维护一个箭头表（address->read or write）,在表上就说明Transaction读或写了此账户(bool1:isRead? bool2:isWrite? bool3:isCreate?)
-		edgeMap := make(map[string][3]bool)
-
+		//接下来开始画调用依赖, 读写集合由 BuildAccessSets 根据 model 生成
 		//Transaction 的图像节点标识符
 		txPort := "port_tx" + fmt.Sprintf("%d", i)
 
-		//Transaction调用的第一个地址From，肯定会读取和改变其 Nonce 所以有依赖关系
-		addAccountNode(from, &graph)               //画上 from 节点
-		edgeMap[from] = [3]bool{true, true, false} //添加进箭头表
-
-		//处理创建合约的特殊情况
-		if tx.To == "nil" {
-			addAccountNode(tx.NewContractAddr.Hex(), &graph)
-			edgeMap[tx.NewContractAddr.Hex()] = [3]bool{false, false, true}
-		}
-
-		//不管有无调用其他合约，只要 Transaction 的 value 不为空就会进行转账操作(创建合约的情况前面处理过了)
-		if tx.Value.Sign() > 0 && tx.To != "nil" { //	value > 0 需要转账
-			addAccountNode(to, &graph) //画上 to 节点
-			edgeMap[to] = [3]bool{true, true, false}
-		}
-
-		if len(tx.CallQueue) > 0 { //有合约调用情况
-
-			for _, contractInfo := range tx.CallQueue { //进入每个调用过程的循环，如果调用的合约有对自身的读写操作，则 tx 图像实例直接指向它
-
-				//是否有读写的标识
-				doRead := false
-				doWrite := false
-
-				for _, keyOpcode := range contractInfo.KeyOpcode {
-					split := strings.Split(keyOpcode, " ")
-					opcode := split[1]
-					if opcode == "BALANCE" || opcode == "SELFBALANCE" { //opcode 为BALANCE需要记录BALANCE访问的地址，因为涉及读操作
-						addAccountNode(split[2], &graph)        //加入新的图节点
-						if value, ok := edgeMap[split[2]]; ok { //	判断防止之前访问过的记录被覆盖
-							value[0] = true
-							edgeMap[split[2]] = value
-						} else {
-							edgeMap[split[2]] = [3]bool{true, false, false}
-						}
-					}
-					if opcode == "SLOAD" {
-						doRead = true
-					}
-					if opcode == "SSTORE" {
-						doWrite = true
-					}
-					if opcode == "CREATE" || opcode == "CREATE2" { //opcode为 create or create2 则新建新创建的合约的图节点，并加入 edgemap箭头标签为“create”，
-						addAccountNode(split[2], &graph) //加入新的图节点
-						edgeMap[split[2]] = [3]bool{false, false, true}
-						if split[3] == "doTransfer_true" { //create 有转账发生
-							doRead = true
-							doWrite = true
-						}
-					}
-					if opcode == "CALL" {
-						if split[3] == "doTransfer_true" { //需要转账
-							addAccountNode(split[2], &graph)
-							if value, ok := edgeMap[split[2]]; ok { //	判断防止之前访问过的记录被覆盖(如果不是有 create 标记这里也不用判断，因为 read write 都为true)
-								value[0] = true
-								value[1] = true
-								edgeMap[split[2]] = value
-							} else {
-								edgeMap[split[2]] = [3]bool{true, true, false}
-							}
-							doRead = true
-							doWrite = true
-						}
-					}
-					if opcode == "SELFDESTRUCT" {
-						addAccountNode(split[2], &graph)
-						if value, ok := edgeMap[split[2]]; ok { //	判断防止之前访问过的记录被覆盖(如果不是有 create 标记这里也不用判断，因为 read write 都为true)
-							value[0] = true
-							value[1] = true
-							edgeMap[split[2]] = value
-						} else {
-							edgeMap[split[2]] = [3]bool{true, true, false}
-						}
-						doRead = true
-						doWrite = true
-					}
-				}
-
-				//判断箭头上应该标注什么信息，并判断当前调用到的地址是否是被转账的地址
-				label := [3]bool{false, false, false}
-				if doRead && doWrite {
-					label = [3]bool{true, true, false}
-				} else if doRead && !doWrite {
-					label = [3]bool{true, false, false}
-				} else if !doRead && doWrite {
-					label = [3]bool{false, true, false}
-				} else { //如果该调用合约没有涉及读或写则继续
-					continue
-				}
-
-				//如果涉及读写则加入图节点
-				addAccountNode(contractInfo.ContractAddr.Hex(), &graph)
-				if value, ok := edgeMap[contractInfo.ContractAddr.Hex()]; ok { //	判断防止之前访问过的记录被覆盖
-					//只要有 1 就是 1
-					edgeMap[contractInfo.ContractAddr.Hex()] = [3]bool{value[0] || label[0], value[1] || label[1], value[2] || label[2]}
-				} else {
-					edgeMap[contractInfo.ContractAddr.Hex()] = label
-				}
-
-			}
-		}
-
-		//根据 EdgeMap 往图里添加边
-		for addr, value := range edgeMap {
-			var label string
-			if value[2] { //要先判断 create 不然会覆盖掉
-				label = "[Create]"
-			} else if value[0] && value[1] {
-				label = "[Read & Write]"
-			} else if !value[0] && value[1] {
-				label = "[Write]"
-			} else if value[0] && !value[1] {
-				label = "[Read]"
-			} else {
-				print("!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!")
-			}
+		//根据读写集合往图里添加账户节点和边
+		set := setList[i]
+		for _, addr := range set.Order {
+			addAccountNode(addr, &graph) //加入新的图节点
+			access := set.Accounts[addr]
+			label := revertedLabel("["+accessLabel(access)+"]", access.Reverted)
 			addEdge(txPort, "port_"+strconv.Itoa(addr2Num[addr]), "->", label, "black", &graph)
+			if access.Reverted { //只来自回滚的调用过程，画为虚线
+				graph.EdgeList[len(graph.EdgeList)-1].AddAttr("style", "dashed")
+			}
 		}
 	}
 
@@ -72,7 +72,7 @@ func GetGraphFromRelationship(g *parallel.Graph, path string, fileName string) {
 		//设置 From To Value的cell
 		row2 := TableRow{}
 		from := tx.From
-		to := tx.To
+		to := toLabel(tx.To)
 		value := tx.Value.String()
 
 		txInfoCell := TableCell{Content: "<b>From: </b>" + from + "<br/>" + "<b>To: </b>" + to + "<br/><b>Value: </b>" + value}
@@ -104,7 +104,11 @@ func GetGraphFromRelationship(g *parallel.Graph, path string, fileName string) {
 
 	//添加边
 	for _, edge := range edgeList {
-		addEdge2Graph("port_tx"+edge.From, "port_account"+edge.To, "->", edge.Op, colorMap[edge.Op], &graph)
+		op, reverted := splitRevertedLabel(edge.Op)
+		addEdge2Graph("port_tx"+edge.From, "port_account"+edge.To, "->", edge.Op, colorMap[op], &graph)
+		if reverted { //只来自回滚的调用过程（见 revert.go），画为虚线
+			graph.EdgeList[len(graph.EdgeList)-1].AddAttr("style", "dashed")
+		}
 	}
 
 	//print(graph.toDOT())
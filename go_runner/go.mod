@@ -2,7 +2,10 @@ module transaction_test
 
 go 1.21.4
 
-require github.com/ethereum/go-ethereum v1.13.14
+require (
+	github.com/ethereum/go-ethereum v1.13.14
+	github.com/google/pprof v0.0.0-20230207041349-798e818bf904
+)
 
 require (
 	github.com/DataDog/zstd v1.4.5 // indirect
@@ -14,9 +14,9 @@ func Cmd(s string) {
 	var out bytes.Buffer
 	err := cmd.Run()
 	if err != nil {
-		print("Cmd error", err)
+		logger.Error("cmd fail", "cmd", s, "err", err)
 	}
-	print("Cmd out: ", out)
+	logger.Debug("cmd out", "cmd", s, "out", out.String())
 }
 
 // Table cell 结构体（row 里面包含许多 cell）（cell	的标签是<td>）
@@ -121,7 +121,7 @@ func (n *Node) AddAttr(attr string, value interface{}) {
 	} else if reflect.TypeOf(value).String() == "int" {
 		n.NodeAttr = append(n.NodeAttr, attr+" = "+strconv.Itoa(value.(int))+" ")
 	} else {
-		print("Node AddAddr value type error")
+		logger.Warn("node attribute value type error", "attr", attr, "type", reflect.TypeOf(value).String())
 	}
 }
 
@@ -238,26 +238,26 @@ func (g *Graph) Draw(path string, fileName string) error {
 	dot := g.toDOT()
 	filePath := path + "/" + fileName + ".gv"
 	imagePath := path + "/" + fileName + ".png"
-	print("Output File Path: ", filePath)
-	print("Output Image Path: ", imagePath)
+	logger.Info("output file", "path", filePath)
+	logger.Info("output image", "path", imagePath)
 
 	//create file and write file
 	file, err := os.Create(filePath)
 	if err != nil {
-		print("Create file error", err)
+		logger.Error("create file fail", "path", filePath, "err", err)
 	}
 	defer file.Close()
 
 	//写入 Dot 格式文本
 	_, err = file.Write([]byte(dot))
 	if err != nil {
-		print("Write file error", err)
+		logger.Error("write file fail", "path", filePath, "err", err)
 	}
 
 	//创建图片文件
 	_, err = os.Create(imagePath)
 	if err != nil {
-		print("Create imageFile error", err)
+		logger.Error("create image file fail", "path", imagePath, "err", err)
 	}
 	defer file.Close()
 	Cmd("dot " + filePath + " -T png -o " + imagePath) //调用系统程序生成 png
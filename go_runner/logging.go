@@ -0,0 +1,69 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件提供分级的结构化日志（debug/info/warn/error），代替原来打印高亮 [Debug Print] 的 print 函数
+//日志默认以文本格式写到标准错误，可以用参数改为 JSON 格式或写入文件，方便 grep 和程序解析:
+//	-log-level debug|info|warn|error    -log-format text|json    -log-file ./output/run.log
+//quiet 模式（见 progress.go）下只输出 warn 及以上级别的日志
+//--------------------------------------------------------------------------------------
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// 日志级别，默认为 info
+var logLevel slog.LevelVar
+
+// 日志格式，text 或 json
+var logFormat string = "text"
+
+// 日志输出
+var logOutput io.Writer = os.Stderr
+
+// 全局日志
+var logger *slog.Logger = newLogger()
+
+// 实际使用的日志级别：quiet 模式下至少为 warn
+type logLeveler struct{}
+
+func (logLeveler) Level() slog.Level {
+	if quiet && logLevel.Level() < slog.LevelWarn {
+		return slog.LevelWarn
+	}
+	return logLevel.Level()
+}
+
+// 按当前的格式和输出新建日志
+func newLogger() *slog.Logger {
+	options := &slog.HandlerOptions{Level: logLeveler{}}
+	if logFormat == "json" {
+		return slog.New(slog.NewJSONHandler(logOutput, options))
+	}
+	return slog.New(slog.NewTextHandler(logOutput, options))
+}
+
+// 给子命令添加 -log-level、-log-format 和 -log-file 参数，解析参数时立即生效
+func logFlags(flagSet *flag.FlagSet) {
+	flagSet.TextVar(&logLevel, "log-level", &logLevel, "log level: debug, info, warn or error")
+	flagSet.Func("log-format", "log format: text or json (default text)", func(value string) error {
+		if value != "text" && value != "json" {
+			return fmt.Errorf("unknown log format: %s", value)
+		}
+		logFormat = value
+		logger = newLogger()
+		return nil
+	})
+	flagSet.Func("log-file", "append logs to this file instead of stderr", func(path string) error {
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		logOutput = file //文件在程序退出时关闭
+		logger = newLogger()
+		return nil
+	})
+}
@@ -0,0 +1,355 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件分析执行区块时的 On-CPU 和 Off-CPU 时间，对应 Rust 的 perf 和 bcc offcputime
+//	On-CPU Time  = CPU profile 的采样时间
+//	Off-CPU Time = 执行区块的 goroutine（调用栈中有 replayFrameList 中的函数）的等待时间，来自 runtime/trace 的 goroutine 分析：
+//	               同步阻塞（channel、select、sync）+ 系统调用（磁盘 IO）+ 网络 IO + 调度等待（可运行但在等待 P）
+//goroutine 分析用 go tool trace -pprof 从 trace 文件中导出，只统计执行区块的 goroutine，与 reth 执行区块的线程的 offcputime 可以比较
+//没有 go 命令或者 trace 文件无法解析时退回到 block profile 和调度器延迟统计，此时统计的是整个进程的所有 goroutine，
+//报告中标为 process-wide wait，空闲的 worker、日志和 GC 等无关 goroutine 的等待也算在内，系统调用的等待不在其中
+//block/mutex profile 是进程启动以来的累计值，这里取开始和结束时的差，只统计采集范围内发生的阻塞，作为参考总是写入文件
+//--------------------------------------------------------------------------------------
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/metrics"
+	"runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// 执行区块的函数，调用栈中有这些函数的 goroutine 算作执行区块的 goroutine
+// prepareBlock 读取区块和全局状态，runBlock 调用 Process（见 process.go）
+var replayFrameList = []string{"main.prepareBlock", "main.runBlock"}
+
+// go tool trace -pprof 导出的等待时间种类及其在报告中的名称
+var traceWaitList = []struct {
+	Kind string
+	Name string
+}{
+	{"sync", "blocking (chan, select, sync)"},
+	{"syscall", "syscall (disk IO)"},
+	{"net", "network IO"},
+	{"sched", "scheduler wait (runnable)"},
+}
+
+// 开始采集时的状态
+type offCPUSnapshot struct {
+	start        time.Time
+	block        *profile.Profile
+	mutex        *profile.Profile
+	schedLatency float64
+}
+
+// 开启 block 和 mutex profile 并记录开始时的状态
+func startOffCPU() *offCPUSnapshot {
+	runtime.SetBlockProfileRate(1)
+	runtime.SetMutexProfileFraction(1)
+	return &offCPUSnapshot{
+		start:        time.Now(),
+		block:        lookupProfile("block"),
+		mutex:        lookupProfile("mutex"),
+		schedLatency: schedLatencySeconds(),
+	}
+}
+
+// 读取 runtime/pprof 中的累计 profile
+func lookupProfile(name string) *profile.Profile {
+	var buf bytes.Buffer
+	if err := pprof.Lookup(name).WriteTo(&buf, 0); err != nil {
+		return nil
+	}
+	prof, err := profile.Parse(&buf)
+	if err != nil {
+		return nil
+	}
+	return prof
+}
+
+// 两个累计 profile 的差 end - start，去掉差为 0 的采样
+func diffProfile(end *profile.Profile, start *profile.Profile) (*profile.Profile, error) {
+	if end == nil {
+		return nil, errors.New("read runtime profile fail")
+	}
+	if start == nil || len(start.Sample) == 0 {
+		return end, nil
+	}
+	base := start.Copy()
+	base.Scale(-1)
+	diff, err := profile.Merge([]*profile.Profile{end, base})
+	if err != nil {
+		return nil, err
+	}
+	sampleList := diff.Sample[:0]
+	for _, sample := range diff.Sample {
+		for _, value := range sample.Value {
+			if value != 0 {
+				sampleList = append(sampleList, sample)
+				break
+			}
+		}
+	}
+	diff.Sample = sampleList
+	return diff, nil
+}
+
+// 整个进程所有 goroutine 的调度器延迟的总和（秒），由 /sched/latencies:seconds 直方图按每个桶的中点估计
+func schedLatencySeconds() float64 {
+	sample := []metrics.Sample{{Name: "/sched/latencies:seconds"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindFloat64Histogram {
+		return 0
+	}
+	histogram := sample[0].Value.Float64Histogram()
+	total := 0.0
+	for i, count := range histogram.Counts {
+		low, high := histogram.Buckets[i], histogram.Buckets[i+1]
+		if math.IsInf(low, -1) {
+			low = high
+		}
+		if math.IsInf(high, 1) {
+			high = low
+		}
+		total += float64(count) * (low + high) / 2
+	}
+	return total
+}
+
+// 单位为纳秒的采样值的下标（CPU profile 为 cpu，block/mutex profile 为 delay），找不到时返回 -1
+func nanosecondsIndex(prof *profile.Profile) int {
+	for i, sampleType := range prof.SampleType {
+		if sampleType.Unit == "nanoseconds" {
+			return i
+		}
+	}
+	return -1
+}
+
+// 调用栈从叶子到根的函数名，内联的函数展开为单独的一帧
+func stackFrames(sample *profile.Sample) []string {
+	frameList := []string{}
+	for _, location := range sample.Location {
+		for _, line := range location.Line {
+			if line.Function != nil {
+				frameList = append(frameList, line.Function.Name)
+			}
+		}
+	}
+	return frameList
+}
+
+// 按 frameOf 得到的名字累计每个采样的时间（秒），返回每个名字的时间和总时间
+func frameSeconds(prof *profile.Profile, frameOf func(sample *profile.Sample) string) (map[string]float64, float64) {
+	frameTime := make(map[string]float64)
+	total := 0.0
+	index := nanosecondsIndex(prof)
+	if index < 0 {
+		return frameTime, total
+	}
+	for _, sample := range prof.Sample {
+		seconds := float64(sample.Value[index]) / 1e9
+		total += seconds
+		if name := frameOf(sample); name != "" {
+			frameTime[name] += seconds
+		}
+	}
+	return frameTime, total
+}
+
+// 火焰图的叶子帧（最内层的内联函数），对应 On-CPU Icicle
+func leafFrame(sample *profile.Sample) string {
+	frameList := stackFrames(sample)
+	if len(frameList) == 0 {
+		return ""
+	}
+	return frameList[0]
+}
+
+// 叶子所在的实际函数（内联展开前），对应 perf report 的 Ranking
+func selfFrame(sample *profile.Sample) string {
+	if len(sample.Location) == 0 || len(sample.Location[0].Line) == 0 {
+		return ""
+	}
+	lines := sample.Location[0].Line
+	if lines[len(lines)-1].Function == nil {
+		return ""
+	}
+	return lines[len(lines)-1].Function.Name
+}
+
+// 阻塞位置：叶子帧和它的调用者，与 offcputime 输出的 "syscall_exit_to_user_mode, entry_SYSCALL_64_after_hwframe" 格式相同
+func blockFrame(sample *profile.Sample) string {
+	frameList := stackFrames(sample)
+	switch len(frameList) {
+	case 0:
+		return ""
+	case 1:
+		return frameList[0]
+	}
+	return frameList[0] + ", " + frameList[1]
+}
+
+// 只保留 keep 返回 true 的采样
+func filterSamples(prof *profile.Profile, keep func(sample *profile.Sample) bool) *profile.Profile {
+	filtered := prof.Copy()
+	filtered.Sample = nil
+	for _, sample := range prof.Copy().Sample {
+		if keep(sample) {
+			filtered.Sample = append(filtered.Sample, sample)
+		}
+	}
+	return filtered
+}
+
+// 采样是否来自执行区块的 goroutine
+func onReplayGoroutine(sample *profile.Sample) bool {
+	for _, frame := range stackFrames(sample) {
+		for _, replayFrame := range replayFrameList {
+			if frame == replayFrame {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 用 go tool trace -pprof 从 trace 文件中导出一种等待时间的 profile
+func readTraceProfile(tracePath string, kind string) (*profile.Profile, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("go", "tool", "trace", "-pprof="+kind, tracePath)
+	cmd.Stderr = &stderr
+	data, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go tool trace -pprof=%s: %v: %s", kind, err, strings.TrimSpace(stderr.String()))
+	}
+	return profile.Parse(bytes.NewReader(data))
+}
+
+// 执行区块的 goroutine 的等待时间：返回每个阻塞位置的时间、每种等待的时间（与 traceWaitList 对应）和总时间
+// 调度等待的位置前加上 "[runnable] "，与同一位置的阻塞区分开
+func replayWait(tracePath string) (map[string]float64, []float64, float64, error) {
+	frameTime := make(map[string]float64)
+	kindTime := make([]float64, len(traceWaitList))
+	total := 0.0
+	for i, wait := range traceWaitList {
+		prof, err := readTraceProfile(tracePath, wait.Kind)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		prefix := ""
+		if wait.Kind == "sched" {
+			prefix = "[runnable] "
+		}
+		waitTime, seconds := frameSeconds(filterSamples(prof, onReplayGoroutine), func(sample *profile.Sample) string {
+			if name := blockFrame(sample); name != "" {
+				return prefix + name
+			}
+			return ""
+		})
+		for name, t := range waitTime {
+			frameTime[name] += t
+		}
+		kindTime[i] = seconds
+		total += seconds
+	}
+	return frameTime, kindTime, total, nil
+}
+
+// 结束采集，根据 CPU profile 文件、trace 文件和开始时的状态生成报告，并把采集范围内的 block/mutex profile 写到 prefix.block.pprof 和 prefix.mutex.pprof
+// tracePath 为空或者无法分析时 Off-CPU 时间退回到整个进程的等待时间
+func (s *offCPUSnapshot) stop(cpuProfilePath string, tracePath string, prefix string) (*CPUReport, error) {
+	report := &CPUReport{ElapsedTime: time.Since(s.start).Seconds()}
+	schedLatency := schedLatencySeconds() - s.schedLatency
+	block, err := diffProfile(lookupProfile("block"), s.block)
+	if err != nil {
+		return nil, err
+	}
+	mutex, err := diffProfile(lookupProfile("mutex"), s.mutex)
+	if err != nil {
+		return nil, err
+	}
+	runtime.SetBlockProfileRate(0)
+	runtime.SetMutexProfileFraction(0)
+
+	for path, prof := range map[string]*profile.Profile{prefix + ".block.pprof": block, prefix + ".mutex.pprof": mutex} {
+		if err := writeProfile(path, prof); err != nil {
+			return nil, err
+		}
+	}
+
+	//On-CPU
+	file, err := os.Open(cpuProfilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	cpu, err := profile.Parse(file)
+	if err != nil {
+		return nil, err
+	}
+	selfTime, onCPU := frameSeconds(cpu, selfFrame)
+	leafTime, _ := frameSeconds(cpu, leafFrame)
+	report.OnCPUTime = onCPU
+	report.OnCPURanking = topFrames(selfTime, onCPU, reportTopN)
+	report.OnCPUIcicle = topFrames(leafTime, onCPU, reportTopN)
+
+	//Off-CPU：执行区块的 goroutine 的等待时间
+	if tracePath != "" {
+		waitTime, kindTime, total, err := replayWait(tracePath)
+		if err == nil {
+			report.OffCPUTime = total
+			report.OffCPUScope = "replay goroutine"
+			report.OffCPUIcicle = topFrames(waitTime, total, reportTopN)
+			for i, wait := range traceWaitList {
+				report.OffCPUBreakdown = append(report.OffCPUBreakdown, FrameShare{Name: wait.Name, Seconds: kindTime[i]})
+			}
+			setBreakdownPercent(report)
+			return report, nil
+		}
+		logger.Warn("analyse trace fail, fall back to process-wide wait", "path", tracePath, "err", err)
+	}
+
+	//退回到整个进程：阻塞的位置加上调度器延迟，都是整个进程的所有 goroutine 的
+	blockTime, blocked := frameSeconds(block, blockFrame)
+	_, mutexWait := frameSeconds(mutex, func(*profile.Sample) string { return "" })
+	report.OffCPUTime = blocked + schedLatency
+	report.OffCPUScope = "process-wide wait, all goroutines"
+	blockTime["[scheduler latency, all goroutines]"] = schedLatency
+	report.OffCPUIcicle = topFrames(blockTime, report.OffCPUTime, reportTopN)
+
+	report.OffCPUBreakdown = []FrameShare{
+		{Name: "blocking (chan, select, sync), all goroutines", Seconds: blocked},
+		{Name: "  of which mutex contention", Seconds: mutexWait},
+		{Name: "scheduler latency, all goroutines", Seconds: schedLatency},
+	}
+	setBreakdownPercent(report)
+	return report, nil
+}
+
+// 以 Off-CPU 时间为基准计算每种来源的百分比
+func setBreakdownPercent(report *CPUReport) {
+	for i := range report.OffCPUBreakdown {
+		if report.OffCPUTime > 0 {
+			report.OffCPUBreakdown[i].Percent = report.OffCPUBreakdown[i].Seconds * 100 / report.OffCPUTime
+		}
+	}
+}
+
+// 把 profile 写入文件，可以用 go tool pprof 查看
+func writeProfile(path string, prof *profile.Profile) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return prof.Write(file)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"runtime/trace"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// 构造一个 block profile，每个采样为 (调用栈从叶子到根, 纳秒)
+func testBlockProfile(sampleList []struct {
+	stack []string
+	nanos int64
+}) *profile.Profile {
+	prof := &profile.Profile{SampleType: []*profile.ValueType{{Type: "contentions", Unit: "count"}, {Type: "delay", Unit: "nanoseconds"}}}
+	functionMap := make(map[string]*profile.Location)
+	for _, s := range sampleList {
+		sample := &profile.Sample{Value: []int64{1, s.nanos}}
+		for _, name := range s.stack {
+			location, ok := functionMap[name]
+			if !ok {
+				function := &profile.Function{ID: uint64(len(functionMap) + 1), Name: name}
+				location = &profile.Location{ID: function.ID, Line: []profile.Line{{Function: function}}}
+				prof.Function = append(prof.Function, function)
+				prof.Location = append(prof.Location, location)
+				functionMap[name] = location
+			}
+			sample.Location = append(sample.Location, location)
+		}
+		prof.Sample = append(prof.Sample, sample)
+	}
+	return prof
+}
+
+func TestFilterReplaySamples(t *testing.T) {
+	prof := testBlockProfile([]struct {
+		stack []string
+		nanos int64
+	}{
+		{[]string{"sync.(*Mutex).Lock", "core.(*StateProcessor).Process", "main.runBlock", "main.main"}, 2e9},
+		{[]string{"syscall.pread", "main.prepareBlock", "main.main"}, 1e9},
+		{[]string{"runtime.chanrecv1", "main.(*RangeReplayer).Run.func1"}, 5e9}, //空闲的 worker
+		{[]string{"runtime.selectgo", "log/slog.(*Logger).Info"}, 7e9},
+	})
+	frameTime, total := frameSeconds(filterSamples(prof, onReplayGoroutine), blockFrame)
+	if total != 3 {
+		t.Errorf("replay goroutine wait = %v seconds, want 3", total)
+	}
+	want := map[string]float64{
+		"sync.(*Mutex).Lock, core.(*StateProcessor).Process": 2,
+		"syscall.pread, main.prepareBlock":                   1,
+	}
+	if !reflect.DeepEqual(frameTime, want) {
+		t.Errorf("frame time = %v, want %v", frameTime, want)
+	}
+	if len(prof.Sample) != 4 {
+		t.Errorf("filterSamples modified the original profile")
+	}
+}
+
+// 执行区块的 goroutine 等待锁 50ms，另一个无关的 goroutine 等待 channel 200ms，只有前者算在 Off-CPU 时间中
+func testReplayLock(mu *sync.Mutex) {
+	mu.Lock()
+	mu.Unlock()
+}
+
+func TestReplayWait(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	defer func(frameList []string) { replayFrameList = frameList }(replayFrameList)
+	replayFrameList = []string{runtime.FuncForPC(reflect.ValueOf(testReplayLock).Pointer()).Name()}
+
+	tracePath := filepath.Join(t.TempDir(), "replay.trace")
+	file, err := os.Create(tracePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := trace.Start(file); err != nil {
+		t.Fatal(err)
+	}
+	idle := make(chan struct{})
+	done := make(chan struct{})
+	go func() { //无关的 goroutine
+		<-idle
+		close(done)
+	}()
+	var mu sync.Mutex
+	mu.Lock()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		mu.Unlock()
+	}()
+	testReplayLock(&mu)
+	time.Sleep(150 * time.Millisecond)
+	close(idle)
+	<-done
+	trace.Stop()
+	file.Close()
+
+	frameTime, kindTime, total, err := replayWait(tracePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncTime := kindTime[0]
+	if syncTime < 0.04 || syncTime > 0.15 {
+		t.Errorf("sync wait of the replay goroutine = %v seconds, want about 0.05", syncTime)
+	}
+	if total < syncTime || total > 0.15 {
+		t.Errorf("off-cpu time = %v seconds, includes unrelated goroutines", total)
+	}
+	if frameTime["sync.(*Mutex).Lock, "+replayFrameList[0]] < 0.04 {
+		t.Errorf("lock wait not attributed to the replay frame: %v", frameTime)
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件根据 rust_runner/check_rust_runner.sh 采集的数据自动生成 rust_runner/data/report.txt 格式的报告（文本和 JSON）
+//	-on   perf record 的采样: perf script -i perf_on.data 的输出（按 period 加权），或者 stackcollapse 之后的 folded stacks
+//	-off  bcc offcputime -df 输出的 folded stacks（out.stacks，单位为微秒）
+//	-stat perf stat 的输出（stat_info.log），用于 Elapsed Time 和 On-CPU Time
+//运行方式: go run . report -on perf_on.script -off out.stacks -stat stat_info.log -out ./output/report
+//--------------------------------------------------------------------------------------
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 调用栈（从根到叶子，用 ; 连接）到采样值的映射，即 folded stacks
+type foldedStacks map[string]float64
+
+// 读取采样文件，自动识别 perf script 和 folded stacks 两种格式
+// 返回每个调用栈的权重和采样次数：perf script 的每个采样按 period 加权（没有 period 时权重为 1），folded stacks 的值就是权重和采样次数
+func readStacks(path string) (foldedStacks, float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+	stacks, samples, err := parseStacks(file)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %v", path, err)
+	}
+	return stacks, samples, nil
+}
+
+// 解析 perf script 或者 folded stacks 格式的采样
+// perf script -F 的采样头可能以数字结尾（例如 -F comm,tid,time,period），与 folded stacks 的一行无法区分，
+// 这样的行要看下一行：下一行是调用栈帧时为采样头，否则为 folded stacks；出现过调用栈帧之后整个文件按 perf script 处理
+func parseStacks(r io.Reader) (foldedStacks, float64, error) {
+	stacks := make(foldedStacks)
+	samples := 0.0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024) //调用栈很深时一行很长
+
+	var frameList []string //perf script 中当前采样的调用栈（从叶子到根）
+	inSample := false
+	weight := 1.0         //perf script 中当前采样的 period
+	isPerfScript := false //出现过调用栈帧
+	pending := ""         //像 folded stacks 的一行，等下一行确定格式
+	flush := func() {
+		if len(frameList) > 0 {
+			reversed := make([]string, len(frameList))
+			for i, frame := range frameList {
+				reversed[len(frameList)-1-i] = frame
+			}
+			stacks[strings.Join(reversed, ";")] += weight
+			samples++
+		}
+		frameList = nil
+		inSample = false
+	}
+	//perf script 的采样头，例如 "rust_runner 1234 [003] 5678.123456:   10101010 cpu-clock:pppH:"
+	startSample := func(line string) {
+		flush()
+		inSample = true
+		weight = perfSamplePeriod(line)
+	}
+	resolvePending := func(nextIsFrame bool) {
+		if pending == "" {
+			return
+		}
+		if nextIsFrame {
+			startSample(pending)
+		} else {
+			flush()
+			stack, value, _ := parseFoldedLine(pending)
+			stacks[stack] += value
+			samples += value
+		}
+		pending = ""
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			resolvePending(false)
+			flush()
+			continue
+		}
+		if strings.HasPrefix(line, "#") { //perf script 的注释
+			continue
+		}
+		//perf script 的调用栈帧以空白开头
+		if line[0] == ' ' || line[0] == '\t' {
+			resolvePending(true)
+			isPerfScript = true
+			if inSample {
+				frameList = append(frameList, perfFrameSymbol(line))
+			}
+			continue
+		}
+		resolvePending(false)
+		if _, _, ok := parseFoldedLine(line); ok && !isPerfScript {
+			pending = line
+			continue
+		}
+		startSample(line)
+	}
+	resolvePending(false)
+	flush()
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	return stacks, samples, nil
+}
+
+// folded stacks 的一行: "frame;frame;... value"
+func parseFoldedLine(line string) (string, float64, bool) {
+	split := strings.LastIndexByte(line, ' ')
+	if split <= 0 {
+		return "", 0, false
+	}
+	value, err := strconv.ParseFloat(line[split+1:], 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return strings.TrimRight(line[:split], " "), value, true
+}
+
+// perf script 采样头中的 period：紧跟在时间戳（"5678.123456:"）之后的整数，没有时返回 1
+func perfSamplePeriod(line string) float64 {
+	fields := strings.Fields(line)
+	for i, field := range fields {
+		if !strings.HasSuffix(field, ":") || i+1 >= len(fields) {
+			continue
+		}
+		if _, err := strconv.ParseFloat(strings.TrimSuffix(field, ":"), 64); err != nil {
+			continue
+		}
+		if period, err := strconv.ParseUint(fields[i+1], 10, 64); err == nil && period > 0 {
+			return float64(period)
+		}
+		return 1
+	}
+	return 1
+}
+
+// perf script 调用栈帧中的符号，例如 "\t    55d5c9a1b2c3 keccak::keccak_p+0x123 (/path/rust_runner)" -> "keccak::keccak_p"
+var perfOffsetRegexp *regexp.Regexp = regexp.MustCompile(`\+0x[0-9a-f]+$`)
+
+func perfFrameSymbol(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return "[unknown]"
+	}
+	symbol := fields[1:]
+	if last := symbol[len(symbol)-1]; len(symbol) > 1 && strings.HasPrefix(last, "(") { //去掉 DSO
+		symbol = symbol[:len(symbol)-1]
+	}
+	return perfOffsetRegexp.ReplaceAllString(strings.Join(symbol, " "), "")
+}
+
+// 按 frameOf 得到的名字累计采样值，返回每个名字的采样值和总采样值
+func (s foldedStacks) frameValues(frameOf func(frameList []string) string) (map[string]float64, float64) {
+	frameValue := make(map[string]float64)
+	total := 0.0
+	for stack, value := range s {
+		total += value
+		if name := frameOf(strings.Split(stack, ";")); name != "" {
+			frameValue[name] += value
+		}
+	}
+	return frameValue, total
+}
+
+// 叶子帧的函数（perf report 的 self 时间）
+func stackLeaf(frameList []string) string {
+	return frameList[len(frameList)-1]
+}
+
+// 火焰图 icicle 的第一层：跳过无法解析的 [unknown] 帧，合并到最近的已知函数
+func stackKnownLeaf(frameList []string) string {
+	for i := len(frameList) - 1; i >= 0; i-- {
+		if frameList[i] != "[unknown]" {
+			return frameList[i]
+		}
+	}
+	return ""
+}
+
+// offcputime 的阻塞位置：进入内核的前两帧，格式为 "被调用者, 调用者"，与 report.txt 相同
+// offcputime -d 用 "-" 或 "--" 分隔用户栈和内核栈，没有分隔符时使用进程名之后的帧
+func offCPUFrame(frameList []string) string {
+	kernel := frameList
+	if len(kernel) > 1 {
+		kernel = kernel[1:] //第一帧为进程名
+	}
+	for i, frame := range frameList {
+		if frame == "-" || frame == "--" {
+			kernel = frameList[i+1:]
+		}
+	}
+	switch len(kernel) {
+	case 0:
+		return ""
+	case 1:
+		return kernel[0]
+	}
+	return kernel[1] + ", " + kernel[0]
+}
+
+// perf stat 的结果
+type perfStat struct {
+	ElapsedTime float64 //seconds time elapsed
+	TaskClock   float64 //task-clock（没有时使用 cpu-clock），单位为秒
+}
+
+// 读取 perf stat 的输出，例如:
+//
+//	34,360.12 msec task-clock                #    0.385 CPUs utilized
+//	89.181234567 seconds time elapsed
+func readPerfStat(path string) (perfStat, error) {
+	stat := perfStat{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return stat, err
+	}
+	cpuClock := 0.0
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.ReplaceAll(fields[0], ",", ""), 64)
+		if err != nil {
+			continue
+		}
+		switch {
+		case fields[1] == "seconds" && fields[2] == "time":
+			stat.ElapsedTime = value
+		case fields[1] == "msec" && fields[2] == "task-clock":
+			stat.TaskClock = value / 1000
+		case fields[1] == "msec" && fields[2] == "cpu-clock":
+			cpuClock = value / 1000
+		}
+	}
+	if stat.TaskClock == 0 {
+		stat.TaskClock = cpuClock
+	}
+	return stat, nil
+}
+
+// 根据采集的数据生成报告，onSamples 为 On-CPU 的采样次数，没有 perf stat 时 On-CPU Time 由采样次数和采样频率估计
+// 百分比按采样的权重（period）计算
+func BuildPerfReport(onStacks foldedStacks, onSamples float64, offStacks foldedStacks, stat perfStat, frequency float64) *CPUReport {
+	report := &CPUReport{ElapsedTime: stat.ElapsedTime, OnCPUTime: stat.TaskClock}
+
+	if onStacks != nil {
+		selfValue, total := onStacks.frameValues(stackLeaf)
+		leafValue, _ := onStacks.frameValues(stackKnownLeaf)
+		if report.OnCPUTime == 0 && frequency > 0 {
+			report.OnCPUTime = onSamples / frequency
+		}
+		//权重换算为时间，使百分比不变
+		toSeconds := func(values map[string]float64) map[string]float64 {
+			seconds := make(map[string]float64)
+			for name, value := range values {
+				if total > 0 {
+					seconds[name] = value / total * report.OnCPUTime
+				}
+			}
+			return seconds
+		}
+		report.OnCPURanking = topFrames(toSeconds(selfValue), report.OnCPUTime, reportTopN)
+		report.OnCPUIcicle = topFrames(toSeconds(leafValue), report.OnCPUTime, reportTopN)
+	}
+
+	if offStacks != nil {
+		frameValue, total := offStacks.frameValues(offCPUFrame)
+		frameSeconds := make(map[string]float64)
+		for name, value := range frameValue {
+			frameSeconds[name] = value / 1e6 //微秒
+		}
+		report.OffCPUTime = total / 1e6
+		report.OffCPUIcicle = topFrames(frameSeconds, report.OffCPUTime, reportTopN)
+	}
+	return report
+}
+
+// 输出 JSON 格式的报告
+func (r *CPUReport) WriteJSON(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// report 子命令
+func ReportCommand(args []string) {
+	flagSet := flag.NewFlagSet("report", flag.ExitOnError)
+	onPath := flagSet.String("on", "", "on-CPU samples: perf script output or folded stacks")
+	offPath := flagSet.String("off", "", "off-CPU folded stacks from offcputime -f (microseconds)")
+	statPath := flagSet.String("stat", "", "perf stat log")
+	frequency := flagSet.Float64("freq", 99, "perf record sampling frequency, used when -stat is not given")
+	format := flagSet.String("format", "all", "output format: text, json or all")
+	outPrefix := flagSet.String("out", "./output/report", "output file prefix, .txt and .json are appended")
+	logFlags(flagSet)
+	flagSet.Parse(args)
+
+	var onStacks, offStacks foldedStacks
+	var onSamples float64
+	var stat perfStat
+	var err error
+	if *onPath != "" {
+		if onStacks, onSamples, err = readStacks(*onPath); err != nil {
+			logger.Error("read on-cpu samples fail", "err", err)
+			return
+		}
+	}
+	if *offPath != "" {
+		if offStacks, _, err = readStacks(*offPath); err != nil {
+			logger.Error("read off-cpu stacks fail", "err", err)
+			return
+		}
+	}
+	if *statPath != "" {
+		if stat, err = readPerfStat(*statPath); err != nil {
+			logger.Error("read perf stat fail", "err", err)
+			return
+		}
+	}
+	report := BuildPerfReport(onStacks, onSamples, offStacks, stat, *frequency)
+
+	if *format == "text" || *format == "all" {
+		file, err := os.Create(*outPrefix + ".txt")
+		if err != nil {
+			logger.Error("create report fail", "err", err)
+			return
+		}
+		report.WriteText(file)
+		file.Close()
+		logger.Info("output report", "path", file.Name())
+	}
+	if *format == "json" || *format == "all" {
+		if err := report.WriteJSON(*outPrefix + ".json"); err != nil {
+			logger.Error("write json report fail", "err", err)
+			return
+		}
+		logger.Info("output report", "path", *outPrefix+".json")
+	}
+}
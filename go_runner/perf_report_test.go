@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestReadStacks(t *testing.T) {
+	testList := []struct {
+		name    string
+		path    string
+		stacks  foldedStacks
+		samples float64
+	}{
+		{"perf script weighted by period", "fixtures/perf_script.txt", foldedStacks{
+			"main;revm::interpreter::run;keccak::keccak_p":             30000000,
+			"main;revm::interpreter::run;__memmove_avx_unaligned_erms": 10000000,
+			"main;revm::interpreter::run;[unknown]":                    10000000,
+		}, 3},
+		{"perf script -F header ending in period", "fixtures/perf_script_period.txt", foldedStacks{
+			"main;keccak::keccak_p":             30000000,
+			"main;__memmove_avx_unaligned_erms": 10000000,
+		}, 2},
+		{"offcputime folded", "fixtures/offcpu.stacks", foldedStacks{
+			"rust_runner;std::sys::pal::unix::fs::File::read;read;-;entry_SYSCALL_64_after_hwframe;syscall_exit_to_user_mode": 32576000,
+			"rust_runner;keccak::keccak_p;-;irqentry_exit_to_user_mode":                                                       16387000,
+			"rust_runner;std::thread::park;futex_wait;-;entry_SYSCALL_64_after_hwframe;do_syscall_64;schedule":                407000,
+		}, 49370000},
+	}
+	for _, test := range testList {
+		stacks, samples, err := readStacks(test.path)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(stacks, test.stacks) {
+			t.Errorf("%s: stacks = %v, want %v", test.name, stacks, test.stacks)
+		}
+		if samples != test.samples {
+			t.Errorf("%s: samples = %v, want %v", test.name, samples, test.samples)
+		}
+	}
+}
+
+func TestParseStacksFormat(t *testing.T) {
+	testList := []struct {
+		name   string
+		input  string
+		stacks foldedStacks
+	}{
+		{"folded", "a;b 3\na;c 2\n", foldedStacks{"a;b": 3, "a;c": 2}},
+		{"folded without trailing newline", "a;b 3", foldedStacks{"a;b": 3}},
+		{"header ending in a number", "comm 12 5.5: 7\n\tff leaf+0x1 (dso)\n\tff root (dso)\n", foldedStacks{"root;leaf": 7}},
+		{"header without period", "comm 12 5.5: cpu-clock:\n\tff leaf (dso)\n", foldedStacks{"leaf": 1}},
+		{"header ending in a number after frames", "comm 1 1.0: 2\n\tff a (dso)\ncomm 1 2.0: 3\n\tff b (dso)\n", foldedStacks{"a": 2, "b": 3}},
+	}
+	for _, test := range testList {
+		stacks, _, err := parseStacks(strings.NewReader(test.input))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(stacks, test.stacks) {
+			t.Errorf("%s: stacks = %v, want %v", test.name, stacks, test.stacks)
+		}
+	}
+}
+
+func TestPerfSamplePeriod(t *testing.T) {
+	testList := []struct {
+		header string
+		want   float64
+	}{
+		{"rust_runner  1234 [003] 5678.100000:   30000000 cpu-clock:pppH: ", 30000000},
+		{"rust_runner 1234/1234 5678.100000: 250000", 250000},
+		{"rust_runner  1234 [003] 5678.100000: cpu-clock:pppH: ", 1},
+		{"rust_runner  1234", 1},
+	}
+	for _, test := range testList {
+		if got := perfSamplePeriod(test.header); got != test.want {
+			t.Errorf("perfSamplePeriod(%q) = %v, want %v", test.header, got, test.want)
+		}
+	}
+}
+
+func TestReadPerfStat(t *testing.T) {
+	stat, err := readPerfStat("fixtures/perf_stat.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.ElapsedTime != 89.181234567 || math.Abs(stat.TaskClock-34.36012) > 1e-9 {
+		t.Errorf("stat = %+v", stat)
+	}
+
+	//没有 task-clock 时使用 cpu-clock
+	path := t.TempDir() + "/stat.log"
+	os.WriteFile(path, []byte("   1,500.00 msec cpu-clock   #  0.5 CPUs utilized\n   3.0 seconds time elapsed\n"), 0644)
+	if stat, err = readPerfStat(path); err != nil {
+		t.Fatal(err)
+	}
+	if stat.ElapsedTime != 3 || stat.TaskClock != 1.5 {
+		t.Errorf("cpu-clock stat = %+v", stat)
+	}
+}
+
+func TestBuildPerfReportWeighted(t *testing.T) {
+	onStacks, onSamples, err := readStacks("fixtures/perf_script.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//没有 perf stat 时 On-CPU Time 由采样次数估计，百分比按 period 计算
+	report := BuildPerfReport(onStacks, onSamples, nil, perfStat{}, 100)
+	if report.OnCPUTime != 0.03 {
+		t.Errorf("on-cpu time = %v, want 0.03", report.OnCPUTime)
+	}
+	want := []FrameShare{
+		{Name: "keccak::keccak_p", Seconds: 0.018, Percent: 60},
+		{Name: "[unknown]", Seconds: 0.006, Percent: 20},
+		{Name: "__memmove_avx_unaligned_erms", Seconds: 0.006, Percent: 20},
+	}
+	checkFrameShares(t, "ranking", report.OnCPURanking, want)
+	//icicle 中 [unknown] 合并到最近的已知函数
+	want = []FrameShare{
+		{Name: "keccak::keccak_p", Seconds: 0.018, Percent: 60},
+		{Name: "__memmove_avx_unaligned_erms", Seconds: 0.006, Percent: 20},
+		{Name: "revm::interpreter::run", Seconds: 0.006, Percent: 20},
+	}
+	checkFrameShares(t, "icicle", report.OnCPUIcicle, want)
+}
+
+func checkFrameShares(t *testing.T, name string, got []FrameShare, want []FrameShare) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s = %v, want %v", name, got, want)
+	}
+	for i := range want {
+		if got[i].Name != want[i].Name || math.Abs(got[i].Seconds-want[i].Seconds) > 1e-9 || math.Abs(got[i].Percent-want[i].Percent) > 1e-9 {
+			t.Errorf("%s[%d] = %+v, want %+v", name, i, got[i], want[i])
+		}
+	}
+}
+
+// report.txt 中的一项，例如 "1. keccak::keccak_p   ( 8.43%, 2.90s )"，返回名字和括号中的每个值
+var reportEntryRegexp = regexp.MustCompile(`^\d+\. (\S+(?:, \S+)?)\s+\( (.*) \)$`)
+
+// 读取 report.txt 中 section 一节的每一项
+func reportSection(text string, section string) map[string][]string {
+	entryMap := make(map[string][]string)
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != section {
+			continue
+		}
+		for _, entry := range lines[i+1:] {
+			match := reportEntryRegexp.FindStringSubmatch(entry)
+			if match == nil {
+				break
+			}
+			entryMap[match[1]] = strings.Split(match[2], ", ")
+		}
+	}
+	return entryMap
+}
+
+// 用与 rust_runner/data/report.txt 对应的采样重新生成报告，输出应与 report.txt 一致
+// report.txt 中 On-CPU Icicle 来自另一次采样（叶子函数的比例比 Ranking 中还小），所以不比较
+func TestBuildPerfReportSample(t *testing.T) {
+	onStacks, onSamples, err := readStacks("fixtures/perf_report.folded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	offStacks, _, err := readStacks("fixtures/offcpu.stacks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat, err := readPerfStat("fixtures/perf_stat.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := BuildPerfReport(onStacks, onSamples, offStacks, stat, 99)
+	var buf bytes.Buffer
+	report.WriteText(&buf)
+	got := buf.String()
+
+	data, err := os.ReadFile("../rust_runner/data/report.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := string(data)
+
+	for _, line := range []string{"Elapsed Time: 89.18 seconds", "On-CPU Time: 34.36 seconds", "Off-CPU Time: 49.37 seconds"} {
+		if !strings.Contains(want, line) {
+			t.Fatalf("report.txt does not contain %q", line)
+		}
+		if !strings.Contains(got, line) {
+			t.Errorf("report does not contain %q:\n%s", line, got)
+		}
+	}
+
+	//Ranking 中 report.txt 只有前两项有时间，只比较 report.txt 中有的值
+	gotRanking, wantRanking := reportSection(got, "On-CPU:"), reportSection(want, "On-CPU:")
+	if len(wantRanking) != 5 {
+		t.Fatalf("report.txt ranking = %v", wantRanking)
+	}
+	for name, values := range wantRanking {
+		if gotValues := gotRanking[name]; len(gotValues) < len(values) || !reflect.DeepEqual(gotValues[:len(values)], values) {
+			t.Errorf("ranking %s = %v, want %v", name, gotValues, values)
+		}
+	}
+
+	gotOff, wantOff := reportSection(got, "Off-CPU Icicle:"), reportSection(want, "Off-CPU Icicle:")
+	if len(wantOff) != 2 {
+		t.Fatalf("report.txt off-cpu icicle = %v", wantOff)
+	}
+	for name, values := range wantOff {
+		if !reflect.DeepEqual(gotOff[name], values) {
+			t.Errorf("off-cpu icicle %s = %v, want %v", name, gotOff[name], values)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件识别对预编译合约（ecrecover、sha256、bn256 等）和系统合约（Cancun 之后的 beacon roots）的调用
+//预编译合约不执行字节码，Hook 只在调用者的 KeyOpcode 中留下 CALL，所以由 EVMLogger 的调用树标记（CallFrame.Kind）
+//预编译合约没有代码和存储，对它们的代码和存在性的读不算作冲突（见 TxAccessSet.addCodeRead），转账仍然会修改预编译合约的余额，照常记录
+//系统合约（beacon roots）只在调用树中分类，读写集合中有意保留对它的读：它的存储只由区块开始时的系统调用写入（不在任何交易中），
+//交易无法写入（只接受 SYSTEM_ADDRESS 的写入），所以交易之间对它的读不会产生冲突
+//预编译合约的时间和 gas 的比例与普通 opcode 差别很大，replay-tx 和区块范围的 opcode 统计（db.go）中单独统计每个预编译合约的次数、时间和 gas
+//本文件不依赖调用树和日志，与 db.go 一起单独编译，调用树的统计见 call_tree.go 的 precompileStats
+//--------------------------------------------------------------------------------------
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// 调用过程的种类（CallFrame.Kind），普通合约为空
+const (
+	framePrecompile = "precompile"
+	frameSystem     = "system"
+)
+
+// 预编译合约的名称（与 core/vm/contracts.go 相同）
+var precompileNames map[common.Address]string = map[common.Address]string{
+	common.BytesToAddress([]byte{0x01}): "ecrecover",
+	common.BytesToAddress([]byte{0x02}): "sha256",
+	common.BytesToAddress([]byte{0x03}): "ripemd160",
+	common.BytesToAddress([]byte{0x04}): "identity",
+	common.BytesToAddress([]byte{0x05}): "modexp",
+	common.BytesToAddress([]byte{0x06}): "bn256Add",
+	common.BytesToAddress([]byte{0x07}): "bn256ScalarMul",
+	common.BytesToAddress([]byte{0x08}): "bn256Pairing",
+	common.BytesToAddress([]byte{0x09}): "blake2f",
+	common.BytesToAddress([]byte{0x0a}): "kzgPointEvaluation",
+}
+
+// 系统合约的名称
+var systemContractNames map[common.Address]string = map[common.Address]string{
+	params.BeaconRootsStorageAddress: "beaconRoots",
+}
+
+// 是否为预编译合约的地址
+// 读写集合中没有区块的硬分叉信息，使用所有硬分叉中的预编译合约（Cancun 之前对 0x0a 的访问也会被去掉，实际中可以忽略）
+func isPrecompileAddr(addr common.Address) bool {
+	_, ok := precompileNames[addr]
+	return ok
+}
+
+// 区块所在硬分叉中启用的预编译合约
+func activePrecompiles(env *vm.EVM) map[common.Address]bool {
+	active := make(map[common.Address]bool)
+	if env == nil {
+		for addr := range precompileNames {
+			active[addr] = true
+		}
+		return active
+	}
+	rules := env.ChainConfig().Rules(env.Context.BlockNumber, env.Context.Random != nil, env.Context.Time)
+	for _, addr := range vm.ActivePrecompiles(rules) {
+		active[addr] = true
+	}
+	return active
+}
+
+// 调用过程的种类和名称，普通合约返回空
+func classifyFrame(to common.Address, precompiles map[common.Address]bool) (string, string) {
+	if precompiles[to] {
+		name, ok := precompileNames[to]
+		if !ok {
+			name = to.Hex()
+		}
+		return framePrecompile, name
+	}
+	if name, ok := systemContractNames[to]; ok {
+		return frameSystem, name
+	}
+	return "", ""
+}
+
+// 一个预编译合约的统计
+type PrecompileStat struct {
+	Name     string  `json:"name"`
+	Address  string  `json:"address"`
+	Count    int64   `json:"count"`
+	TimeNs   int64   `json:"time_ns"` //CaptureEnter 到 CaptureExit 的时间
+	Gas      uint64  `json:"gas"`
+	NsPerGas float64 `json:"ns_per_gas"`
+}
+
+// 按时间从大到小排序的预编译合约统计，同时计算 ns/gas
+func sortedPrecompileStats(statMap map[string]*PrecompileStat) []PrecompileStat {
+	statList := make([]PrecompileStat, 0, len(statMap))
+	for _, stat := range statMap {
+		if stat.Gas > 0 {
+			stat.NsPerGas = float64(stat.TimeNs) / float64(stat.Gas)
+		}
+		statList = append(statList, *stat)
+	}
+	sort.Slice(statList, func(i, j int) bool {
+		if statList[i].TimeNs != statList[j].TimeNs {
+			return statList[i].TimeNs > statList[j].TimeNs
+		}
+		return statList[i].Name < statList[j].Name
+	})
+	return statList
+}
+
+// 把一个区块的统计累加到 statMap 中（按地址）
+func addPrecompileStats(statMap map[string]*PrecompileStat, statList []PrecompileStat) {
+	for _, stat := range statList {
+		total, ok := statMap[stat.Address]
+		if !ok {
+			total = &PrecompileStat{Name: stat.Name, Address: stat.Address}
+			statMap[stat.Address] = total
+		}
+		total.Count += stat.Count
+		total.TimeNs += stat.TimeNs
+		total.Gas += stat.Gas
+	}
+}
+
+// 只统计预编译合约调用的 EVMLogger，用于区块范围的 opcode 统计（db.go 的 ReadTest3），不记录调用树
+// 每个 opcode 都会回调 CaptureState，会使插桩 geth 测得的 opcode 时间略微变大
+type precompileTracer struct {
+	precompiles map[common.Address]bool //区块所在硬分叉中启用的预编译合约，第一次 CaptureStart 时设置
+	callStack   []precompileCall        //当前的调用栈
+	statMap     map[string]*PrecompileStat
+}
+
+// 调用栈中的一个调用过程，只有预编译合约需要计时
+type precompileCall struct {
+	addr       common.Address
+	precompile bool
+	start      time.Time
+}
+
+// 保证 precompileTracer 实现了 EVMLogger
+var _ vm.EVMLogger = (*precompileTracer)(nil)
+
+func newPrecompileTracer() *precompileTracer {
+	return &precompileTracer{statMap: make(map[string]*PrecompileStat)}
+}
+
+func (t *precompileTracer) enter(to common.Address, create bool) {
+	call := precompileCall{addr: to, precompile: !create && t.precompiles[to]}
+	if call.precompile {
+		call.start = time.Now()
+	}
+	t.callStack = append(t.callStack, call)
+}
+
+func (t *precompileTracer) exit(gasUsed uint64) {
+	if len(t.callStack) == 0 {
+		return
+	}
+	call := t.callStack[len(t.callStack)-1]
+	t.callStack = t.callStack[:len(t.callStack)-1]
+	if !call.precompile {
+		return
+	}
+	stat, ok := t.statMap[call.addr.Hex()]
+	if !ok {
+		_, name := classifyFrame(call.addr, t.precompiles)
+		stat = &PrecompileStat{Name: name, Address: call.addr.Hex()}
+		t.statMap[call.addr.Hex()] = stat
+	}
+	stat.Count++
+	stat.TimeNs += time.Since(call.start).Nanoseconds()
+	stat.Gas += gasUsed
+}
+
+func (t *precompileTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	if t.precompiles == nil {
+		t.precompiles = activePrecompiles(env)
+	}
+	t.enter(to, create)
+}
+
+func (t *precompileTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {
+	t.exit(gasUsed)
+}
+
+func (t *precompileTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	t.enter(to, typ == vm.CREATE || typ == vm.CREATE2)
+}
+
+func (t *precompileTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	t.exit(gasUsed)
+}
+
+func (t *precompileTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+}
+func (t *precompileTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+func (t *precompileTracer) CaptureTxStart(gasLimit uint64) {}
+func (t *precompileTracer) CaptureTxEnd(restGas uint64)    {}
+
+// 按时间从大到小排序的统计
+func (t *precompileTracer) stats() []PrecompileStat {
+	return sortedPrecompileStats(t.statMap)
+}
+
+// 输出预编译合约的统计
+func writePrecompileStats(w io.Writer, statList []PrecompileStat) {
+	for _, stat := range statList {
+		fmt.Fprintf(w, "\t%-20s count: %-8d time: %-12s gas: %-10d ns/gas: %.2f\n", stat.Name, stat.Count, time.Duration(stat.TimeNs), stat.Gas, stat.NsPerGas)
+	}
+}
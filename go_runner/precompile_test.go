@@ -0,0 +1,99 @@
+package main
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/parallel"
+)
+
+func TestPrecompileTracer(t *testing.T) {
+	sender := common.HexToAddress("0x1111")
+	contract := common.HexToAddress("0x3333")
+	ecrecover, sha256 := common.BytesToAddress([]byte{0x01}), common.BytesToAddress([]byte{0x02})
+
+	tracer := newPrecompileTracer()
+	//第一笔交易调用合约，合约调用两次 ecrecover 和一次 sha256，并创建一个合约
+	tracer.CaptureStart(nil, sender, contract, false, nil, 100000, big.NewInt(0))
+	tracer.CaptureEnter(vm.STATICCALL, contract, ecrecover, nil, 5000, nil)
+	tracer.CaptureExit(nil, 3000, nil)
+	tracer.CaptureEnter(vm.STATICCALL, contract, ecrecover, nil, 5000, nil)
+	tracer.CaptureExit(nil, 3000, nil)
+	tracer.CaptureEnter(vm.CALL, contract, common.HexToAddress("0x4444"), nil, 5000, big.NewInt(0))
+	tracer.CaptureEnter(vm.STATICCALL, common.HexToAddress("0x4444"), sha256, nil, 5000, nil)
+	tracer.CaptureExit(nil, 72, nil)
+	tracer.CaptureExit(nil, 1000, nil)
+	tracer.CaptureEnter(vm.CREATE, contract, ecrecover, nil, 5000, big.NewInt(0)) //不可能创建在预编译合约的地址上，不计入
+	tracer.CaptureExit(nil, 32000, nil)
+	tracer.CaptureEnd(nil, 50000, nil)
+	//第二笔交易直接调用 sha256
+	tracer.CaptureStart(nil, sender, sha256, false, nil, 100000, big.NewInt(0))
+	tracer.CaptureEnd(nil, 60, nil)
+
+	got := map[string]PrecompileStat{}
+	for _, stat := range tracer.stats() {
+		if stat.TimeNs < 0 {
+			t.Errorf("%s: negative time", stat.Name)
+		}
+		stat.TimeNs, stat.NsPerGas = 0, 0
+		got[stat.Name] = stat
+	}
+	want := map[string]PrecompileStat{
+		"ecrecover": {Name: "ecrecover", Address: ecrecover.Hex(), Count: 2, Gas: 6000},
+		"sha256":    {Name: "sha256", Address: sha256.Hex(), Count: 2, Gas: 132},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestAddPrecompileStats(t *testing.T) {
+	ecrecover := common.BytesToAddress([]byte{0x01}).Hex()
+	total := map[string]*PrecompileStat{}
+	addPrecompileStats(total, []PrecompileStat{{Name: "ecrecover", Address: ecrecover, Count: 1, TimeNs: 100, Gas: 3000}})
+	addPrecompileStats(total, []PrecompileStat{{Name: "ecrecover", Address: ecrecover, Count: 2, TimeNs: 200, Gas: 6000}})
+	want := []PrecompileStat{{Name: "ecrecover", Address: ecrecover, Count: 3, TimeNs: 300, Gas: 9000, NsPerGas: 300.0 / 9000}}
+	if got := sortedPrecompileStats(total); !reflect.DeepEqual(got, want) {
+		t.Errorf("total = %+v, want %+v", got, want)
+	}
+}
+
+// 对预编译合约的代码和存在性的读不算作冲突，对它的转账和 BALANCE 照常记录
+func TestBuildAccessSetsPrecompile(t *testing.T) {
+	sender := common.HexToAddress("0x1111")
+	contract := common.HexToAddress("0x3333")
+	other := common.HexToAddress("0x5555")
+	precompile := func(b byte) string { return common.BytesToAddress([]byte{b}).Hex() }
+	testList := []struct {
+		name      string
+		keyOpcode string
+		want      map[string]AccountAccess
+	}{
+		{"call without transfer", "[Read&Write] CALL " + precompile(0x01) + " doTransfer_false", map[string]AccountAccess{}},
+		{"staticcall", "[Read] STATICCALL " + precompile(0x02), map[string]AccountAccess{}},
+		{"extcodesize", "[Read] EXTCODESIZE " + precompile(0x03), map[string]AccountAccess{}},
+		{"extcodehash", "[Read] EXTCODEHASH " + precompile(0x09), map[string]AccountAccess{}},
+		{"call with transfer", "[Read&Write] CALL " + precompile(0x04) + " doTransfer_true", map[string]AccountAccess{
+			precompile(0x04): {Read: true, Write: true},
+			contract.Hex():   {Read: true, Write: true},
+		}},
+		{"balance", "[Read] BALANCE " + precompile(0x05), map[string]AccountAccess{precompile(0x05): {Read: true}}},
+		{"call to a contract", "[Read&Write] CALL " + other.Hex() + " doTransfer_false", map[string]AccountAccess{other.Hex(): {Read: true}}},
+	}
+	for _, test := range testList {
+		blockInfo := &parallel.BlockInfo{Tx: []*parallel.TxInfo{{From: sender, To: contract.Hex(), Value: big.NewInt(0), CallQueue: []*parallel.CallInfo{
+			{Layer: 1, ContractAddr: contract, KeyOpcode: []string{test.keyOpcode}},
+		}}}}
+		set := BuildAccessSets(blockInfo, common.Address{}, ConflictModel{})[0]
+		got := map[string]AccountAccess{}
+		for addr, access := range set.Accounts {
+			got[addr] = *access
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: accounts = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
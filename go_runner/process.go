@@ -1,31 +1,24 @@
 package main
 
 import (
-	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"math"
 	"os"
-	"strconv"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/parallel"
 )
 
-// Debug print
-func print(item ...interface{}) { //利用 interface{} 来传递任意参数, 用...表示不限参数的个数
-	//fmt.Print("[Debug]")
-	fmt.Printf("%c[31;40;5m%s%c[0m", 0x1B, "[Debug Print]", 0x1B) //打印高亮文本
-	for i := range item {
-		fmt.Print(" ", item[i])
-	}
-	fmt.Print("\n")
-}
-
 //已经被 Hook 方法代替
 // 解决了问题：如何读取指定区块的信息（交易，gas等）？
 // 读取指定区块的交易信息,	并将交易转换为消息 Message
@@ -67,67 +60,133 @@ type hook struct {
 }
 
 // 打印 Hook 信息并以 Json 形式返回
+// 每笔交易的信息打印为 debug 级别的日志，需要 -log-level debug 才能看到
 func OutputBlockHookInfo() {
 
 	// //打印Hook从程序中勾取的信息, 包括 contract 的调用以及执行的 opcode
-	print("Block Hash: ", parallel.GetBlockInfo().BlockHash)
-	print("GasLimit: ", parallel.GetBlockInfo().GasLimit)
+	logger.Debug("hook block", "hash", parallel.GetBlockInfo().BlockHash, "gas_limit", parallel.GetBlockInfo().GasLimit)
 	for i, tx := range parallel.GetBlockInfo().Tx {
-		fmt.Printf("\n\n\n------------------------------------Transaction %d------------------------------------\n", i)
-		print("Tx Hash", tx.TxHash)
-		print("Tx From: ", tx.From)
-		print("Tx To: ", tx.To)
-		print("Tx Value: ", tx.Value)
-		print("Tx GasPrice: ", tx.GasPrice)
-		//print("Tx Data: ", tx.Data)
+		logger.Debug("hook tx", "tx", i, "hash", tx.TxHash, "from", tx.From, "to", txToLabel(tx), "value", tx.Value, "gas_price", tx.GasPrice)
+		//logger.Debug("hook tx data", "tx", i, "data", tx.Data)
 		for _, q := range tx.CallQueue {
-			//fmt.Printf("\nInvoke Contract: %d\n", j+1)
-			fmt.Print("\n")
-			print("Invoke Layer: ", q.Layer)
-			print("Contract Address: ", q.ContractAddr)
-			//print("Contract Opcode: ", q.OpcodeList)
+			logger.Debug("hook call", "tx", i, "layer", q.Layer, "contract", q.ContractAddr)
+			//logger.Debug("hook call opcodes", "tx", i, "opcodes", q.OpcodeList)
 			for _, op := range q.KeyOpcode {
-				print("Key Opcode: ", op)
+				logger.Debug("hook key opcode", "tx", i, "layer", q.Layer, "contract", q.ContractAddr, "opcode", op)
 			}
-			//print("Last Opcode: ", q.OpcodeList[len(q.OpcodeList)-1])
 		}
 	}
 
-	//	将 BlockInfo 对象转化为 Json 对象
-	jsonData, _ := json.Marshal(parallel.GetBlockInfo())
+	//	将 BlockInfo 对象转化为 Json 对象，创建合约的交易 To 为 null（见 creation.go）
+	jsonData, _ := json.Marshal(exportBlockInfo(parallel.GetBlockInfo()))
 	file, err := os.Create("./output/txLog.json") //创建输出文件
 	if err != nil {
-		print(err)
+		logger.Error("create tx log fail", "err", err)
 	}
 	file.Write(jsonData)
 	defer file.Close()
 
 }
 
-// 从一个区块执行前的全局状态模拟执行一个区块
-func DoProcess(blockNumber uint64) {
+// 本地归档节点的数据目录
+var chainDataDir string = "/home/user/common/docker/volumes/cp1_eth-docker_geth-eth1-data/_data/geth/chaindata"
 
-	//读取数据库
-	chainDataDir := "/home/user/common/docker/volumes/cp1_eth-docker_geth-eth1-data/_data/geth/chaindata"
+// 打开本地节点的数据库
+func openChainDB() (ethdb.Database, error) {
 	ancientDir := chainDataDir + "/ancient"
-	db, err := rawdb.Open(
+	return rawdb.Open(
 		rawdb.OpenOptions{
 			Directory:         chainDataDir,
 			AncientsDirectory: ancientDir,
 			Ephemeral:         true,
 		},
 	)
+}
+
+// 打开数据库解析区块集合，数据库打不开时仍然可以解析不需要数据库的写法
+// 解析完成后关闭数据库，避免和 DoProcess 打开的数据库冲突
+func loadBlockSet(spec string) ([]uint64, error) {
+	db, err := openChainDB()
+	if err != nil {
+		return ParseBlockSet(spec, nil)
+	}
+	defer db.Close()
+	return ParseBlockSet(spec, db)
+}
+
+// DoProcess 失败的原因，用于区分无法计算加速比的区块
+var (
+	errBlockMissing = errors.New("block or parent block not found")
+	errStateMissing = errors.New("state of parent block is missing")
+	errReplay       = errors.New("blockchain process fail")
+)
+
+// 打开数据库并用读取的数据新建数据链，调用者负责关闭数据库
+func openChain() (ethdb.Database, *core.BlockChain, error) {
+	db, err := openChainDB()
+	if err != nil {
+		logger.Error("open rawdb fail", "err", err)
+		return nil, nil, err
+	}
+
+	bc, err := newChain(db) //链配置和共识引擎见 chain.go
+	if err != nil {
+		logger.Error("new blockchain fail", "err", err)
+		db.Close()
+		return nil, nil, err
+	}
+	return db, bc, nil
+}
+
+// 从一个区块执行前的全局状态模拟执行一个区块
+// 返回执行的区块以及交易收据（收据中有每笔交易消耗的 gas）
+func DoProcess(blockNumber uint64) (*types.Block, types.Receipts, error) {
+
+	//读取数据库，用读取的数据新建数据链
+	db, bc, err := openChain()
+	if err != nil {
+		return nil, nil, err
+	}
 	defer db.Close() //这句很必要，因为如果连续调用 DoProcess 函数不释放 db 资源的话会有锁读取不了
+
+	return processBlock(db, bc, blockNumber)
+}
+
+// 在已经打开的数据链上执行一个区块，连续执行多个区块时可以共用同一个数据库
+func processBlock(db ethdb.Database, bc *core.BlockChain, blockNumber uint64) (*types.Block, types.Receipts, error) {
+	execution, err := executeBlock(db, bc, blockNumber)
+	return execution.Block, execution.Receipts, err
+}
+
+// 一个区块的执行结果
+type blockExecution struct {
+	Block    *types.Block
+	Receipts types.Receipts
+	UsedGas  uint64
+	ExecTime time.Duration  //Process 调用的时间
+	StateDB  *state.StateDB //执行之后的全局状态（prepareBlock 返回时为执行之前的全局状态）
+
+	TraceCallContext bool //执行时是否记录调用树（见 call_context.go），prepareBlock 设为 traceCallContext
+}
+
+// 执行一个区块并返回执行结果，出错时返回的结果中可能只有 Block
+// 并行执行时调用者要持有 hookLock，只需要在 runBlock 期间持有锁时分别调用 prepareBlock 和 runBlock
+func executeBlock(db ethdb.Database, bc *core.BlockChain, blockNumber uint64) (*blockExecution, error) {
+	execution, err := prepareBlock(db, bc, blockNumber)
 	if err != nil {
-		print("👎Open rawdb fail!", err)
+		return execution, err
 	}
+	return execution, runBlock(bc, execution)
+}
 
-	//用读取的数据新建数据链
-	bc, _ := core.NewBlockChain(db, core.DefaultCacheConfigWithScheme(rawdb.HashScheme), nil, nil, ethash.NewFaker(), vm.Config{}, nil, nil)
+// 读取区块和父区块执行之后的全局状态，不涉及 Hook 的数据，并行执行时不需要持有 hookLock
+// 返回的 StateDB 为区块执行前的全局状态，出错时返回的结果中可能只有 Block
+func prepareBlock(db ethdb.Database, bc *core.BlockChain, blockNumber uint64) (*blockExecution, error) {
+	execution := &blockExecution{TraceCallContext: traceCallContext}
 
 	//读取特定的区块
 	//var blockNumber uint64 = 9800644
-	//var blockNumber uint64 = 9833300 //包含创建合约的 Transaction (TODO:需要特殊处理不然报错)
+	//var blockNumber uint64 = 9833300 //包含创建合约的 Transaction（见 creation.go）
 	//var blockNumber uint64 = 9831292                              // Nice Picture
 	//var blockNumber uint64 = 9898821
 	blockHash := rawdb.ReadCanonicalHash(db, blockNumber)         //当前选取的区块 Hash
@@ -135,103 +194,310 @@ func DoProcess(blockNumber uint64) {
 	block := rawdb.ReadBlock(db, blockHash, blockNumber)
 	parentBlock := rawdb.ReadBlock(db, parentBlockHash, blockNumber-1)
 	if block == nil || parentBlock == nil {
-		print("👎Read block or parent block fail!", err)
+		logger.Error("read block or parent block fail", "block", blockNumber)
+		return execution, errBlockMissing
 	}
+	execution.Block = block
 
 	//用父区块获得当前区块执行前的区块链全局状态
 	parentBlockRoot := parentBlock.Root()
 	stateDb, err := bc.StateAt(parentBlockRoot)
 	if err != nil {
-		print("👎Get State fail!", err)
+		logger.Error("get state fail", "block", blockNumber, "err", err)
+		return execution, fmt.Errorf("%w: %v", errStateMissing, err)
 	}
+	execution.StateDB = stateDb
+	return execution, nil
+}
+
+// 在 prepareBlock 准备好的全局状态上执行区块，执行之后 StateDB 为执行之后的全局状态
+// 执行时插桩的 geth 写入全局的 Hook 数据，并记录 lastCallContext，并行执行时要持有 hookLock
+func runBlock(bc *core.BlockChain, execution *blockExecution) error {
+	block, stateDb := execution.Block, execution.StateDB
+	blockNumber := block.NumberU64()
 
 	//ReadBlockTx(block, db, core.DefaultCacheConfigWithScheme(rawdb.HashScheme))
 
-	_, _, usedGas, err := bc.Processor().Process(block, stateDb, vm.Config{})
+	//replay 开启 block 范围的 profile 时只采集 Process 调用（见 profiling.go）
+	stopProfile := blockProfiler.Start(fmt.Sprintf("block_%d", blockNumber))
+	startTime := time.Now()
+	vmConfig := vm.Config{}
+	var callContext *callContextTracer
+	if execution.TraceCallContext { //记录调用树，用于确定 DELEGATECALL 的存储地址（见 call_context.go）
+		callContext = newCallContextTracer(block.Hash())
+		vmConfig.Tracer = callContext
+	}
+	receipts, _, usedGas, err := bc.Processor().Process(block, stateDb, vmConfig)
+	execution.ExecTime = time.Since(startTime)
+	stopProfile()
+	lastCallContext = callContext
+	execution.Receipts = receipts
 	if err != nil {
-		print("👎Blockchain process fail!", err)
+		logger.Error("blockchain process fail", "block", blockNumber, "err", err)
+		return fmt.Errorf("%w: %v", errReplay, err)
 	}
-	print("Gas Used: ", usedGas)
+	execution.UsedGas = usedGas
+
+	//检查执行结果是否与区块头一致（见 validate.go）
+	if validateReplay {
+		if err := validateExecution(bc.Config(), block, stateDb, receipts, usedGas); err != nil {
+			logger.Error("block validation fail", "block", blockNumber, "err", err)
+			return err
+		}
+	}
+	forkList := headerForks(bc.Config(), block.Header())
+	logger.Info("block processed", "block", blockNumber, "txs", len(block.Transactions()), "gas_used", usedGas, "fork", forkList[len(forkList)-1], "forks", forkList)
 
 	//OutputBlockHookInfo()
 
+	return nil
 }
 
-// 输出100个块的平均并行加速比
-func OutputAverageSpeedUp() {
-	readFile, err := os.Open("block_range.csv")
-	if err != nil {
-		print(err)
+// 加速比无法计算（NaN 或者无穷大）的原因
+const (
+	reasonNoTx         = "no_transactions"   //区块中没有交易
+	reasonZeroTime     = "zero_time"         //测得的执行时间为 0
+	reasonInfinite     = "infinite_speedup"  //关键路径的时间为 0，加速比为无穷大
+	reasonReplayError  = "replay_error"      //区块执行出错
+	reasonBlockMissing = "block_missing"     //区块或父区块不在数据库中
+	reasonStateMissing = "state_missing"     //父区块的状态不在数据库中（已被裁剪）
+	reasonValidation   = "validation_failed" //执行结果与区块头不一致（-validate）
+	reasonHookMismatch = "hook_mismatch"     //Hook 记录的交易数与收据数不一致，无法按 gas 加权
+)
+
+// 根据 DoProcess 返回的错误得到原因
+func errorReason(err error) string {
+	if errors.Is(err, errBlockMissing) {
+		return reasonBlockMissing
+	}
+	if errors.Is(err, errStateMissing) {
+		return reasonStateMissing
+	}
+	if errors.Is(err, errValidation) {
+		return reasonValidation
 	}
-	defer readFile.Close()
+	return reasonReplayError
+}
+
+// 被排除的区块及其原因
+type excludedBlock struct {
+	BlockNumber uint64
+	Reason      string
+	Detail      string
+}
+
+// OutputAverageSpeedUp 的累计结果，保存在检查点中
+type speedUpAggregates struct {
+	SpeedupList    []float64
+	GasSpeedupList []float64
+	ExcludedList   []excludedBlock
+}
 
-	writeFile, err := os.Create("./output/SpeedUp.txt")
+// 输出100个块的平均并行加速比
+// 时间加速比来自插桩 geth 的 BuildTxRelationGraph（需要 geth 内部测得的每笔交易的时间），冲突按 geth 的 Hook 判断：
+// 对合约自身的读写记在代码地址上，不区分 DELEGATECALL 的存储地址、回滚的调用过程和预编译合约
+// 同时输出以 gas 为权重的加速比（关键路径的 gas / 区块总 gas），读写集合来自 access_set.go 的 BuildAccessSets（按 model 建模，
+// 存储地址、回滚、预编译合约和账户级读操作都按本地的规则处理），它不受运行时间波动的影响，每个块只需要计算一次
+// 计算读写集合时额外执行一次区块并记录调用树（-storage-context），计时的几次执行不记录，避免 EVMLogger 影响时间
+// 无法计算加速比的区块会连同原因一起列在文件最后
+// replayer 决定区块是否并行执行（Hook 的数据是全局的，区块的执行部分仍然是串行的，并行只节省读取区块和状态的时间）
+// checkpoint 为 nil 时不保存检查点
+func OutputAverageSpeedUp(blockList []uint64, replayer *RangeReplayer, checkpoint *Checkpoint, model ConflictModel) {
+	writeFile, err := openOutputFile("./output/SpeedUp.txt", checkpoint.Resumed())
 	if err != nil {
-		print(err)
+		logger.Error("open output file fail", "err", err)
+		return
 	}
 	defer writeFile.Close()
 
 	//存放块号和并行执行时间的映射
 	//block_speedup_mapmap := make(map[uint64]float64)
 	loopCnt := 5 //每个块重复执行几次取平均
-	var averageSpeedup float64 = 0.0
 
-	csvReader := csv.NewReader(readFile)
-	blockList, err := csvReader.ReadAll()
+	//累计结果，从检查点继续执行时先恢复
+	var aggregates speedUpAggregates
+	if err := checkpoint.LoadAggregates(&aggregates); err != nil {
+		logger.Error("load checkpoint aggregates fail", "err", err)
+		return
+	}
 
-	blockCnt := len(blockList) //区块的总数
-	legalBlockCnt := 0         //和法 Block 的数量（因为有的 Block 里面没有 Transaction 无法计算时间）
+	//区块在原区块列表中的序号，从检查点继续执行时序号保持不变
+	blockIndex := make(map[uint64]int)
+	for i, blockNumber := range blockList {
+		blockIndex[blockNumber] = i
+	}
 
+	//所有区块共用同一个数据库
+	db, bc, err := openChain()
 	if err != nil {
-		print(err)
+		return
+	}
+	defer db.Close()
+
+	//一个区块的执行结果
+	type blockSpeedUp struct {
+		avgSpeedUp float64
+		gasSpeedUp float64
+		txCnt      int
+		usedGas    uint64
+		processErr error
 	}
-	for i := 0; i < blockCnt; i++ {
-		blockNumber, err := strconv.ParseUint(blockList[i][0], 10, 64)
-		if err != nil {
-			print(err)
-		}
 
-		var blockAvgSpeedUp float64 = 0.0
-		for i := 0; i < loopCnt; i++ {
-			DoProcess(blockNumber)
+	//在 worker 中执行一个区块，读取区块和父区块的状态在锁外进行，多个 worker 可以同时读取
+	//Hook 的数据是全局的，所以执行区块和读取 Hook 数据要在锁内完成
+	work := func(blockNumber uint64) interface{} {
+		result := blockSpeedUp{avgSpeedUp: 0.0, gasSpeedUp: math.NaN()}
+		//第 0 次执行记录调用树并计算 gas 加速比（gas 加速比是确定的，只需要计算一次），之后的 loopCnt 次执行计时
+		for j := 0; j <= loopCnt; j++ {
+			execution, err := prepareBlock(db, bc, blockNumber) //每次执行都要重新获取执行前的状态
+			if err != nil {
+				result.processErr = err
+				break
+			}
+			execution.TraceCallContext = execution.TraceCallContext && j == 0
+			hookLock.Lock()
+			if err := runBlock(bc, execution); err != nil { //执行失败则不再重复执行
+				hookLock.Unlock()
+				result.processErr = err
+				break
+			}
+			if j == 0 {
+				setList := BuildAccessSets(parallel.GetBlockInfo(), execution.Block.Coinbase(), model)
+				hookLock.Unlock()
+				result.txCnt = len(execution.Receipts)
+				result.usedGas = execution.Block.GasUsed()
+				result.gasSpeedUp = EstimateSpeedUp(setList, gasWeights(execution.Receipts))
+				continue
+			}
 			_, _, speedup := parallel.BuildTxRelationGraph()
-			blockAvgSpeedUp += speedup / float64(loopCnt)
+			hookLock.Unlock()
+			result.avgSpeedUp += speedup / float64(loopCnt)
+		}
+		if result.processErr != nil {
+			result.avgSpeedUp = math.NaN()
+			result.gasSpeedUp = math.NaN()
 		}
+		return result
+	}
+
+	remaining := checkpoint.Remaining(blockList)
+	progress := NewProgress(len(remaining))
+
+	//按区块顺序输出结果
+	emit := func(_ int, blockNumber uint64, res interface{}) {
+		i := blockIndex[blockNumber]
+		result := res.(blockSpeedUp)
+		blockAvgSpeedUp := result.avgSpeedUp
+		blockGasSpeedUp := result.gasSpeedUp
 
 		//block_speedup_mapmap[blockNumber] = blockAvgSpeedUp
-		if !math.IsNaN(blockAvgSpeedUp) { //如果能计算时间则该块和法
-			legalBlockCnt++
-			averageSpeedup += blockAvgSpeedUp
+		if !math.IsNaN(blockAvgSpeedUp) && !math.IsInf(blockAvgSpeedUp, 0) { //如果能计算时间则该块和法
+			aggregates.SpeedupList = append(aggregates.SpeedupList, blockAvgSpeedUp)
+		}
+		if !math.IsNaN(blockGasSpeedUp) && !math.IsInf(blockGasSpeedUp, 0) {
+			aggregates.GasSpeedupList = append(aggregates.GasSpeedupList, blockGasSpeedUp)
+		}
+		fmt.Fprint(writeFile, "[ Block ", i, " ]  Block number: ", blockNumber, "  Block average speedup: ", blockAvgSpeedUp, "  Block gas speedup: ", blockGasSpeedUp)
+
+		//说明加速比为 NaN 或者无穷大的原因
+		if math.IsInf(blockAvgSpeedUp, 0) {
+			excluded := excludedBlock{BlockNumber: blockNumber, Reason: reasonInfinite}
+			excluded.Detail = fmt.Sprint(result.txCnt, " transactions but measured critical path time is zero")
+			aggregates.ExcludedList = append(aggregates.ExcludedList, excluded)
+			fmt.Fprint(writeFile, "  (Inf: ", excluded.Reason, ")")
+		} else if math.IsNaN(blockAvgSpeedUp) {
+			excluded := excludedBlock{BlockNumber: blockNumber}
+			if result.processErr != nil {
+				excluded.Reason = errorReason(result.processErr)
+				excluded.Detail = result.processErr.Error()
+			} else if result.txCnt == 0 {
+				excluded.Reason = reasonNoTx
+				excluded.Detail = "empty block"
+			} else {
+				excluded.Reason = reasonZeroTime
+				excluded.Detail = fmt.Sprint(result.txCnt, " transactions but measured execution time is zero")
+			}
+			aggregates.ExcludedList = append(aggregates.ExcludedList, excluded)
+			fmt.Fprint(writeFile, "  (NaN: ", excluded.Reason, ")")
 		}
-		fmt.Fprintln(writeFile, "[ Block", i, "]  Block number:", blockNumber, " Block average speedup:", blockAvgSpeedUp)
+		fmt.Fprint(writeFile, "\n")
 
+		//每个区块完成后保存检查点
+		if err := checkpoint.Save(blockNumber, &aggregates); err != nil {
+			logger.Warn("save checkpoint fail", "block", blockNumber, "err", err)
+		}
+		progress.Add(result.usedGas, result.processErr != nil)
 	}
 
-	averageSpeedup /= float64(legalBlockCnt)
-	fmt.Fprintln(writeFile, "Legal Block Count:", legalBlockCnt)
-	fmt.Fprintln(writeFile, "Average Speedup:", averageSpeedup)
+	replayer.Run(remaining, work, emit)
+
+	fmt.Fprintln(writeFile, "Legal Block Count:", len(aggregates.SpeedupList))
+	fmt.Fprintln(writeFile, "Average Speedup:", mean(aggregates.SpeedupList))
+	fmt.Fprintln(writeFile, "Speedup Stats:", summarize(aggregates.SpeedupList))
+	fmt.Fprintln(writeFile, "Gas Speedup Model:", model, " storage-context:", traceCallContext, " revert-policy:", revertPolicy)
+	fmt.Fprintln(writeFile, "Gas Legal Block Count:", len(aggregates.GasSpeedupList))
+	fmt.Fprintln(writeFile, "Average Gas Speedup:", mean(aggregates.GasSpeedupList))
+	fmt.Fprintln(writeFile, "Gas Speedup Stats:", summarize(aggregates.GasSpeedupList))
+
+	fmt.Fprintln(writeFile, "Excluded Block Count:", len(aggregates.ExcludedList))
+	for _, excluded := range aggregates.ExcludedList {
+		fmt.Fprintln(writeFile, "Excluded Block:", excluded.BlockNumber, " Reason:", excluded.Reason, " Detail:", excluded.Detail)
+	}
 
 }
 
+// speedup 子命令：输出平均并行加速比到 ./output/SpeedUp.txt
+func SpeedUpCommand(args []string) {
+	flagSet := flag.NewFlagSet("speedup", flag.ExitOnError)
+	blockSpec := flagSet.String("blocks", "block_range.csv", "block set, see block_set.go")
+	workers := flagSet.Int("workers", 1, "number of workers, 0 means all CPUs; blocks still execute one at a time under hookLock, see replayer.go")
+	serial := flagSet.Bool("serial", false, "replay blocks one by one, for timing-sensitive runs")
+	coinbase := flagSet.Bool("coinbase", false, "count the fee payment to coinbase as a conflict in the gas speedup")
+	sender := flagSet.Bool("sender", true, "count the sender nonce and fee deduction as a conflict in the gas speedup")
+	openCheckpoint := checkpointFlags(flagSet, "speedup")
+	progressFlags(flagSet)
+	validateFlags(flagSet)
+	callContextFlags(flagSet)
+	chainFlags(flagSet)
+	logFlags(flagSet)
+	flagSet.Parse(args)
+
+	blockList, err := loadBlockSet(*blockSpec)
+	if err != nil {
+		logger.Error("parse block set fail", "err", err)
+		return
+	}
+	checkpoint, err := openCheckpoint()
+	if err != nil {
+		logger.Error("open checkpoint fail", "err", err)
+		return
+	}
+	OutputAverageSpeedUp(blockList, NewRangeReplayer(*workers, *serial), checkpoint, ConflictModel{IncludeCoinbase: *coinbase, IncludeSender: *sender})
+}
+
 func main() {
 
-	// 重定向输出，不在命令行打印
-	var noPrint = false //为 true 则不打印
-	if noPrint {
-		os.Stdout = nil
+	// 命令行指定了子命令则只运行子命令（见 commands.go），例如 go run . cluster
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1], os.Args[2:])
+		return
 	}
 
+	// 不在命令行打印调试信息（只输出 warn 及以上级别的日志，见 logging.go）
+	quiet = false //为 true 则不打印
+
 	// 运行一个区块的函数，让区块执行一遍获取运行的 opcode 等信息
 	fmt.Print("DoProcess()\n")
 	DoProcess(9833300)
 	fmt.Print("\n\n")
 
 	// 获取 Transaction 和 Account 之间的关系图
-	// go run process.go graph_utils.go get_invoke_graph.go
+	// go run process.go graph_utils.go get_invoke_graph.go access_set.go
 	// fmt.Print("DoProcess()\n")
-	// DoProcess(9833300)
+	// block, _, _ := DoProcess(9833300)
 	// fmt.Print("\n\nGetGraphDemo()\n")
-	// GetGraphDemo("/home/user/data/Brian/brian_eth_runner/go_runner/output", "GetGraphDemo")
+	// // 是否把 coinbase 手续费和发送者 nonce 算作读写由 ConflictModel 决定
+	// GetGraphDemo("/home/user/data/Brian/brian_eth_runner/go_runner/output", "GetGraphDemo", block.Coinbase(), ConflictModel{IncludeSender: true})
 
 	// 将 Graph 导出为 Json 格式
 	// go run process.go graph_utils.go get_invoke_graph.go
@@ -247,6 +513,10 @@ func main() {
 	// fmt.Print("BuildGraph()\n")
 	// // 只保留会导致Transaction并行冲突的 Account（如果一个 Account 与两个 Transaction 关连则需保留这个节点）
 	// var graph *parallel.Graph = parallel.BuildDependencyGraph()
+	// // 或者使用 access_set.go 中的读写集合，自己决定是否包含 coinbase 手续费和发送者 nonce 导致的冲突
+	// // go run process.go graph_utils.go get_relationship_graph.go access_set.go
+	// // block, _, _ := DoProcess(9833300)
+	// // var graph *parallel.Graph = BuildModelDependencyGraph(parallel.GetBlockInfo(), block.Coinbase(), ConflictModel{IncludeSender: true})
 	// // 根据返回的关系图的点和边的信息画图
 	// GetGraphFromRelationship(graph, "/home/user/data/Brian/brian_eth_runner/go_runner/output", "GetGraphFromRelationship")
 	// fmt.Print("\n\n")
@@ -262,6 +532,13 @@ func main() {
 	// fmt.Print("\n\n")
 
 	// 根据文件block_range.csv 输出100个块的平均并行加速比
-	//OutputAverageSpeedUp()
+	// 也可以运行 go run . speedup -blocks block_range.csv
+	// blockList, _ := ReadBlockList("block_range.csv")
+	// OutputAverageSpeedUp(blockList, NewRangeReplayer(1, true), nil, ConflictModel{IncludeSender: true})
+
+	// 根据文件block_range.csv 输出100个块在不同冲突建模方式下（是否包含 coinbase 手续费、发送者 nonce）的平均并行加速比
+	// 也可以运行 go run . conflict-speedup -blocks block_range.csv
+	// blockList, _ := ReadBlockList("block_range.csv")
+	// OutputConflictModelSpeedUp(blockList, nil)
 
 }
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrorReason(t *testing.T) {
+	testList := []struct {
+		err  error
+		want string
+	}{
+		{errBlockMissing, reasonBlockMissing},
+		{fmt.Errorf("%w: missing trie node", errStateMissing), reasonStateMissing},
+		{fmt.Errorf("%w: gas used", errValidation), reasonValidation},
+		{fmt.Errorf("%w: invalid nonce", errReplay), reasonReplayError},
+		{errors.New("unknown"), reasonReplayError},
+	}
+	for _, test := range testList {
+		if got := errorReason(test.err); got != test.want {
+			t.Errorf("errorReason(%v) = %s, want %s", test.err, got, test.want)
+		}
+	}
+}
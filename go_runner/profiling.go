@@ -0,0 +1,230 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件在执行区块时采集 Go 的 pprof CPU/heap profile 和 runtime/trace，对应 rust_runner/check_rust_runner.sh 中的 perf
+//采集范围可以是每个区块的 Process 调用（block），也可以是整个区块集合（range）
+//CPU profile 可以导出为 FlameGraph 的 folded stacks 格式（与 stackcollapse-perf.pl 的输出相同），方便与 Rust 的火焰图比较:
+//	flamegraph.pl ./output/profile/block_9833300.cpu.folded > go.svg
+//-offcpu 同时采集 trace 和 block/mutex profile，输出与 rust_runner/data/report.txt 格式相同的 <label>.report.txt/.json（见 offcpu.go）
+//其中的 Off-CPU 时间由 trace 的 goroutine 分析得到，只统计执行区块的 goroutine
+//--------------------------------------------------------------------------------------
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// 采集范围
+const (
+	profileScopeBlock = "block" //每个区块的 Process 调用
+	profileScopeRange = "range" //整个区块集合
+)
+
+// 在 processBlock 中采集 Process 调用的 Profiler，只在 block 范围时设置
+// CPU profile 同一时间只能有一个，所以 block 范围必须串行执行区块
+var blockProfiler *Profiler
+
+// Profile 采集配置
+type Profiler struct {
+	Dir    string //输出目录
+	CPU    bool   //CPU profile: <label>.cpu.pprof
+	Heap   bool   //heap profile: <label>.heap.pprof
+	Trace  bool   //runtime/trace: <label>.trace
+	Folded bool   //把 CPU profile 导出为 folded stacks: <label>.cpu.folded
+	OffCPU bool   //On-CPU/Off-CPU 分析: <label>.report.txt、<label>.block.pprof、<label>.mutex.pprof，需要 CPU profile 和 trace
+	Scope  string //block 或 range
+}
+
+// 给子命令添加采集 profile 的参数，没有开启任何采集时返回 nil
+func profilerFlags(flagSet *flag.FlagSet) func() (*Profiler, error) {
+	p := &Profiler{}
+	flagSet.StringVar(&p.Dir, "profile-dir", "./output/profile", "output directory of profiles")
+	flagSet.BoolVar(&p.CPU, "cpuprofile", false, "capture a pprof CPU profile")
+	flagSet.BoolVar(&p.Heap, "heapprofile", false, "capture a pprof heap profile")
+	flagSet.BoolVar(&p.Trace, "trace", false, "capture a runtime/trace execution trace")
+	flagSet.BoolVar(&p.Folded, "folded", false, "export the CPU profile as FlameGraph folded stacks")
+	flagSet.BoolVar(&p.OffCPU, "offcpu", false, "write an on-CPU/off-CPU report of the replay goroutine from the CPU profile and trace (implies -cpuprofile and -trace)")
+	flagSet.StringVar(&p.Scope, "profile-scope", profileScopeBlock, "profile each Process call (block) or the whole block set (range)")
+	return func() (*Profiler, error) {
+		if p.OffCPU { //On-CPU 时间来自 CPU profile，Off-CPU 时间来自 trace
+			p.CPU = true
+			p.Trace = true
+		}
+		if !p.CPU && !p.Heap && !p.Trace {
+			return nil, nil
+		}
+		if p.Scope != profileScopeBlock && p.Scope != profileScopeRange {
+			return nil, fmt.Errorf("unknown profile scope: %s", p.Scope)
+		}
+		if p.Folded && !p.CPU {
+			return nil, fmt.Errorf("-folded requires -cpuprofile")
+		}
+		if err := os.MkdirAll(p.Dir, 0755); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+}
+
+// 开始采集，label 用作输出文件名的前缀，返回的函数结束采集并写入文件
+// p 为 nil 时什么也不做
+func (p *Profiler) Start(label string) (stop func()) {
+	if p == nil {
+		return func() {}
+	}
+	prefix := filepath.Join(p.Dir, label)
+
+	var snapshot *offCPUSnapshot
+	if p.OffCPU {
+		snapshot = startOffCPU()
+	}
+	var cpuFile, traceFile *os.File
+	if p.CPU {
+		file, err := os.Create(prefix + ".cpu.pprof")
+		if err == nil {
+			err = pprof.StartCPUProfile(file)
+		}
+		if err != nil {
+			logger.Error("start cpu profile fail", "label", label, "err", err)
+		} else {
+			cpuFile = file
+		}
+	}
+	if p.Trace {
+		file, err := os.Create(prefix + ".trace")
+		if err == nil {
+			err = trace.Start(file)
+		}
+		if err != nil {
+			logger.Error("start trace fail", "label", label, "err", err)
+		} else {
+			traceFile = file
+		}
+	}
+
+	return func() {
+		//先停止 CPU profile，避免把停止 trace 和导出文件的开销算进去
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+		}
+		tracePath := ""
+		if traceFile != nil {
+			trace.Stop()
+			traceFile.Close()
+			tracePath = traceFile.Name()
+			logger.Info("output trace", "path", tracePath)
+		}
+		if cpuFile != nil && snapshot != nil { //Off-CPU 分析要在 trace 写完之后
+			if err := writeCPUReport(snapshot, cpuFile.Name(), tracePath, prefix); err != nil {
+				logger.Error("write off-cpu report fail", "label", label, "err", err)
+			}
+		}
+		if cpuFile != nil {
+			cpuFile.Close()
+			logger.Info("output cpu profile", "path", cpuFile.Name())
+			if p.Folded {
+				if err := WriteFoldedStacks(cpuFile.Name(), prefix+".cpu.folded"); err != nil {
+					logger.Error("export folded stacks fail", "label", label, "err", err)
+				}
+			}
+		}
+		if p.Heap {
+			if err := writeHeapProfile(prefix + ".heap.pprof"); err != nil {
+				logger.Error("write heap profile fail", "label", label, "err", err)
+			}
+		}
+	}
+}
+
+// 生成 On-CPU/Off-CPU 报告并写入 prefix.report.txt 和 prefix.report.json（与 report 子命令的输出格式相同）
+func writeCPUReport(snapshot *offCPUSnapshot, cpuProfilePath string, tracePath string, prefix string) error {
+	report, err := snapshot.stop(cpuProfilePath, tracePath, prefix)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(prefix + ".report.txt")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	report.WriteText(file)
+	logger.Info("output on-cpu and off-cpu report", "path", file.Name(), "off_cpu_scope", report.OffCPUScope)
+	return report.WriteJSON(prefix + ".report.json")
+}
+
+// 写 heap profile，先 GC 一次让统计信息是最新的
+func writeHeapProfile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(file); err != nil {
+		return err
+	}
+	logger.Info("output heap profile", "path", path)
+	return nil
+}
+
+// 把 pprof CPU profile 转换为 FlameGraph 的 folded stacks 格式
+// 每行为 "root;caller;...;leaf count"，count 为采样次数，内联的函数展开为单独的一帧
+func WriteFoldedStacks(pprofPath string, foldedPath string) error {
+	file, err := os.Open(pprofPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	prof, err := profile.Parse(file)
+	if err != nil {
+		return fmt.Errorf("%s: %v", pprofPath, err)
+	}
+
+	//CPU profile 的第一个 sample 类型为采样次数（samples/count）
+	stackCount := make(map[string]int64)
+	for _, sample := range prof.Sample {
+		frameList := []string{}
+		for i := len(sample.Location) - 1; i >= 0; i-- { //Location 从叶子到根，folded stacks 从根到叶子
+			lines := sample.Location[i].Line
+			for j := len(lines) - 1; j >= 0; j-- { //Line[0] 是最内层的内联函数
+				if lines[j].Function != nil {
+					frameList = append(frameList, strings.ReplaceAll(lines[j].Function.Name, ";", ":"))
+				}
+			}
+		}
+		if len(frameList) > 0 && len(sample.Value) > 0 {
+			stackCount[strings.Join(frameList, ";")] += sample.Value[0]
+		}
+	}
+
+	stackList := make([]string, 0, len(stackCount))
+	for stack := range stackCount {
+		stackList = append(stackList, stack)
+	}
+	sort.Strings(stackList)
+
+	out, err := os.Create(foldedPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	writer := bufio.NewWriter(out)
+	for _, stack := range stackList {
+		fmt.Fprintf(writer, "%s %d\n", stack, stackCount[stack])
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	logger.Info("output folded stacks", "path", foldedPath)
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件在执行一组区块时报告进度: 已完成/总数、blocks/s、gas/s、预计剩余时间（ETA）以及出错的区块数
+//进度写到标准错误，每隔一段时间打印一行，重定向标准输出或开启 quiet 模式时仍然可以看到进度
+//quiet 模式只关闭 warn 以下级别的日志（见 logging.go），不再用 os.Stdout = nil 的方式关闭全部输出
+//--------------------------------------------------------------------------------------
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// 为 true 时只输出 warn 及以上级别的日志
+var quiet bool = false
+
+// 打印进度的时间间隔
+var progressInterval time.Duration = 10 * time.Second
+
+// 给子命令添加 -quiet 和 -progress 参数
+func progressFlags(flagSet *flag.FlagSet) {
+	flagSet.BoolVar(&quiet, "quiet", quiet, "only log warnings and errors, still report progress")
+	flagSet.DurationVar(&progressInterval, "progress", progressInterval, "interval between progress lines, 0 prints after every block")
+}
+
+// 区块执行的进度
+type Progress struct {
+	Total  int    //需要执行的区块数量
+	Done   int    //已经完成的区块数量（包括出错的区块）
+	Errors int    //出错的区块数量
+	Gas    uint64 //已经执行的 gas
+
+	out       io.Writer
+	start     time.Time
+	lastPrint time.Time
+}
+
+// 新建进度，total 为需要执行的区块数量（从检查点继续执行时不包括已经完成的区块）
+func NewProgress(total int) *Progress {
+	now := time.Now()
+	return &Progress{Total: total, out: os.Stderr, start: now, lastPrint: now}
+}
+
+// 记录一个完成的区块，failed 表示区块执行出错
+// 距离上次打印超过 progressInterval 或者所有区块都已完成时打印一行进度
+func (p *Progress) Add(gasUsed uint64, failed bool) {
+	p.Done++
+	p.Gas += gasUsed
+	if failed {
+		p.Errors++
+	}
+	now := time.Now()
+	if p.Done >= p.Total || now.Sub(p.lastPrint) >= progressInterval {
+		p.lastPrint = now
+		fmt.Fprintln(p.out, p.String())
+	}
+}
+
+// 进度的文本格式，例如:
+// [Progress] 12/100 (12.0%)  0.85 blocks/s  12.31 Mgas/s  ETA 1m43s  errors: 0
+func (p *Progress) String() string {
+	elapsed := time.Since(p.start).Seconds()
+	blockRate, gasRate := 0.0, 0.0
+	if elapsed > 0 {
+		blockRate = float64(p.Done) / elapsed
+		gasRate = float64(p.Gas) / elapsed
+	}
+	percent := 100.0
+	if p.Total > 0 {
+		percent = float64(p.Done) * 100 / float64(p.Total)
+	}
+	eta := "unknown"
+	if p.Done >= p.Total {
+		eta = "0s"
+	} else if blockRate > 0 {
+		eta = (time.Duration(float64(p.Total-p.Done) / blockRate * float64(time.Second))).Round(time.Second).String()
+	}
+	return fmt.Sprintf("[Progress] %d/%d (%.1f%%)  %.2f blocks/s  %.2f Mgas/s  ETA %s  errors: %d",
+		p.Done, p.Total, percent, blockRate, gasRate/1e6, eta, p.Errors)
+}
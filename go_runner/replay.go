@@ -0,0 +1,120 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件提供 replay 子命令：执行一组区块并记录每个区块的执行时间和 gas，可以同时采集 profile（见 profiling.go）
+//每个区块的结果按 block_result.go 中与 rust_runner 共用的格式写入 -results 指定的 CSV
+//运行方式: go run . replay -blocks 9833300 -cpuprofile -folded [-heapprofile] [-trace] [-offcpu] [-profile-scope block|range]
+//--------------------------------------------------------------------------------------
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// 一个区块的执行结果
+type replayResult struct {
+	result BlockResult
+	err    error
+}
+
+// replay 子命令
+func ReplayCommand(args []string) {
+	flagSet := flag.NewFlagSet("replay", flag.ExitOnError)
+	blockSpec := flagSet.String("blocks", "9833300", "block set, see block_set.go")
+	workers := flagSet.Int("workers", 1, "number of workers, 0 means all CPUs; blocks still execute one at a time under hookLock, see replayer.go")
+	serial := flagSet.Bool("serial", false, "replay blocks one by one, for timing-sensitive runs")
+	resultFile := flagSet.String("results", "./output/go_result.csv", "output CSV file of block results, see block_result.go")
+	openProfiler := profilerFlags(flagSet)
+	progressFlags(flagSet)
+	validateFlags(flagSet)
+	chainFlags(flagSet)
+	logFlags(flagSet)
+	flagSet.Parse(args)
+
+	blockList, err := loadBlockSet(*blockSpec)
+	if err != nil {
+		logger.Error("parse block set fail", "err", err)
+		return
+	}
+	profiler, err := openProfiler()
+	if err != nil {
+		logger.Error("open profiler fail", "err", err)
+		return
+	}
+
+	replayer := NewRangeReplayer(*workers, *serial)
+	if profiler != nil && profiler.Scope == profileScopeBlock {
+		//同一时间只能采集一个 CPU profile，每个区块单独采集时必须串行执行
+		if replayer.Workers > 1 {
+			logger.Warn("block scope profiling replays blocks serially", "workers", replayer.Workers)
+			replayer.Workers = 1
+		}
+		blockProfiler = profiler
+		defer func() { blockProfiler = nil }()
+	}
+
+	db, bc, err := openChain()
+	if err != nil {
+		return
+	}
+	defer db.Close()
+
+	writeFile, err := os.Create(*resultFile)
+	if err != nil {
+		logger.Error("create result file fail", "err", err)
+		return
+	}
+	defer writeFile.Close()
+	csvWriter := csv.NewWriter(writeFile)
+	defer csvWriter.Flush()
+	csvWriter.Write(blockResultCSVHeader)
+
+	//读取区块和状态在锁外进行，执行区块会写入全局的 Hook 数据和 lastCallContext，多个 worker 时要在 hookLock 内执行
+	work := func(blockNumber uint64) interface{} {
+		execution, err := prepareBlock(db, bc, blockNumber)
+		if err != nil {
+			return replayResult{err: err}
+		}
+		hookLock.Lock()
+		err = runBlock(bc, execution)
+		hookLock.Unlock()
+		if err != nil {
+			return replayResult{err: err}
+		}
+		block := execution.Block
+		return replayResult{result: BlockResult{
+			BlockNumber:  blockNumber,
+			GasUsed:      execution.UsedGas,
+			TxCount:      len(block.Transactions()),
+			ExecTime:     execution.ExecTime,
+			StateRoot:    execution.StateDB.IntermediateRoot(bc.Config().IsEIP158(block.Number())).Hex(),
+			ReceiptsRoot: types.DeriveSha(execution.Receipts, trie.NewStackTrie(nil)).Hex(),
+		}}
+	}
+
+	progress := NewProgress(len(blockList))
+	emit := func(_ int, blockNumber uint64, res interface{}) {
+		replay := res.(replayResult)
+		result := replay.result
+		if replay.err != nil {
+			logger.Warn("replay block fail", "block", blockNumber, "err", replay.err)
+		} else {
+			logger.Info("replay block", "block", blockNumber, "txs", result.TxCount, "gas_used", result.GasUsed, "exec_time", result.ExecTime)
+			csvWriter.Write(result.toCSV())
+			csvWriter.Flush()
+		}
+		progress.Add(result.GasUsed, replay.err != nil)
+	}
+
+	//range 范围的 profile 覆盖整个区块集合
+	if profiler != nil && profiler.Scope == profileScopeRange {
+		stop := profiler.Start(fmt.Sprintf("range_%d_%d", blockList[0], blockList[len(blockList)-1]))
+		defer stop()
+	}
+	replayer.Run(blockList, work, emit)
+}
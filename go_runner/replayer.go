@@ -0,0 +1,88 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件把一组区块分给多个 worker 并行执行，每个区块都从自己父区块的状态开始执行，互不影响
+//所有 worker 共用调用者打开的同一个数据库，结果按输入顺序（区块列表的顺序）交给调用者
+//注意：Hook 的数据（parallel.GetBlockInfo）是全局的，执行区块（Process）和读取 Hook 数据的部分要用 hookLock 串行执行，只有读取区块和打开父区块的状态在锁外并行
+//bc.StateAt 只打开状态树的根，账户和存储的读取都发生在 Process 中，所以多个 worker 几乎不能提高吞吐量，反而会在计时的 Process 执行时占用 CPU
+//因此各子命令默认 -workers 1（串行执行），要真正并行执行区块需要 geth 为每次执行提供独立的 Hook 数据
+//db.go 单独运行时只能使用不依赖 go_runner 其他文件的代码，所以本文件以及 block_list.go、checkpoint.go、progress.go、validate.go、chain.go、block_set.go、precompile.go、cancun.go
+//都不使用 logger 等其他文件中的定义: go run db.go block_list.go replayer.go checkpoint.go progress.go validate.go chain.go block_set.go precompile.go cancun.go
+//--------------------------------------------------------------------------------------
+
+import (
+	"runtime"
+	"sync"
+)
+
+// 保护全局 Hook 数据的锁，执行区块并读取 Hook 数据的过程要在锁内完成
+var hookLock sync.Mutex
+
+// 并行执行一组区块
+type RangeReplayer struct {
+	Workers int //worker 的数量，小于等于 1 时串行执行（对时间敏感的测量应该串行执行）
+}
+
+// 新建 RangeReplayer，serial 为 true 时强制串行执行，workers 小于等于 0 时使用全部 CPU（执行区块仍然是串行的，见文件开头）
+func NewRangeReplayer(workers int, serial bool) *RangeReplayer {
+	if serial {
+		workers = 1
+	} else if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return &RangeReplayer{Workers: workers}
+}
+
+// 执行区块列表中的每个区块
+// work 在 worker 中执行一个区块并返回结果，emit 按区块列表的顺序收到每个区块的结果（emit 总是在同一个 goroutine 中调用）
+func (r *RangeReplayer) Run(blockList []uint64, work func(blockNumber uint64) interface{}, emit func(index int, blockNumber uint64, result interface{})) {
+	//串行执行
+	if r.Workers <= 1 {
+		for i, blockNumber := range blockList {
+			emit(i, blockNumber, work(blockNumber))
+		}
+		return
+	}
+
+	type replayResult struct {
+		index  int
+		result interface{}
+	}
+	jobs := make(chan int)
+	results := make(chan replayResult, r.Workers)
+
+	var wg sync.WaitGroup
+	for w := 0; w < r.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results <- replayResult{index: i, result: work(blockList[i])}
+			}
+		}()
+	}
+	go func() {
+		for i := range blockList {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	//结果重新排序：先到的结果先缓存，等前面的区块都完成后再按顺序交给 emit
+	pending := make(map[int]interface{})
+	next := 0
+	for res := range results {
+		pending[res.index] = res.result
+		for {
+			result, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			emit(next, blockList[next], result)
+			next++
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewRangeReplayer(t *testing.T) {
+	if r := NewRangeReplayer(8, true); r.Workers != 1 {
+		t.Errorf("serial: workers = %d, want 1", r.Workers)
+	}
+	if r := NewRangeReplayer(3, false); r.Workers != 3 {
+		t.Errorf("workers = %d, want 3", r.Workers)
+	}
+	if r := NewRangeReplayer(0, false); r.Workers < 1 {
+		t.Errorf("all CPUs: workers = %d", r.Workers)
+	}
+}
+
+func TestRangeReplayerRun(t *testing.T) {
+	blockList := []uint64{15, 3, 9, 1, 12, 7, 4, 20, 2, 11}
+	for _, workers := range []int{1, 4, len(blockList) + 2} {
+		var running, maxRunning int32
+		//区块号越小执行越慢，让后面的区块先完成
+		work := func(blockNumber uint64) interface{} {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Duration(20-blockNumber) * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			if blockNumber%3 == 0 {
+				return fmt.Errorf("block %d: %w", blockNumber, errReplayTest)
+			}
+			return blockNumber * 10
+		}
+
+		indexList, gotList := []int{}, []uint64{}
+		failedList := []uint64{}
+		emit := func(index int, blockNumber uint64, result interface{}) {
+			indexList = append(indexList, index)
+			gotList = append(gotList, blockNumber)
+			switch result := result.(type) {
+			case error:
+				if !errors.Is(result, errReplayTest) || result.Error() != fmt.Sprintf("block %d: %v", blockNumber, errReplayTest) {
+					t.Errorf("workers %d: block %d got error %v", workers, blockNumber, result)
+				}
+				failedList = append(failedList, blockNumber)
+			case uint64:
+				if result != blockNumber*10 {
+					t.Errorf("workers %d: block %d got result %d", workers, blockNumber, result)
+				}
+			}
+		}
+		(&RangeReplayer{Workers: workers}).Run(blockList, work, emit)
+
+		if !reflect.DeepEqual(gotList, blockList) {
+			t.Errorf("workers %d: emitted %v, want %v", workers, gotList, blockList)
+		}
+		if want := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}; !reflect.DeepEqual(indexList, want) {
+			t.Errorf("workers %d: indexes %v, want %v", workers, indexList, want)
+		}
+		if want := []uint64{15, 3, 9, 12}; !reflect.DeepEqual(failedList, want) {
+			t.Errorf("workers %d: failed %v, want %v", workers, failedList, want)
+		}
+		if workers == 1 && maxRunning != 1 {
+			t.Errorf("serial run had %d blocks running at once", maxRunning)
+		}
+	}
+}
+
+func TestRangeReplayerEmpty(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		(&RangeReplayer{Workers: workers}).Run(nil, func(uint64) interface{} {
+			t.Error("work called for empty block list")
+			return nil
+		}, func(int, uint64, interface{}) {
+			t.Error("emit called for empty block list")
+		})
+	}
+}
+
+var errReplayTest = errors.New("replay fail")
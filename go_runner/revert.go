@@ -0,0 +1,110 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件处理回滚（revert）的调用过程和失败的交易
+//Hook 的 KeyOpcode 在执行时记录，所在的调用过程之后回滚时 SSTORE、转账等写操作并没有真正写入，全部算作写会高估冲突
+//回滚状态来自 call_context.go 记录的调用树：调用过程或者它的任意一个祖先出错即为回滚，最外层调用出错即为交易失败
+//交易失败时手续费和 nonce 照常修改，只有 value 转账和创建合约被回滚
+//没有调用树（-storage-context=false）时无法判断，全部按没有回滚处理
+//回滚的写操作按 -revert-policy 处理（读操作确实发生了，始终保留）:
+//	keep     保留为写
+//	read     降级为读（默认）
+//	exclude  去掉
+//图中只来自回滚调用过程的边画为虚线，标签后加 " (reverted)"
+//--------------------------------------------------------------------------------------
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/parallel"
+)
+
+// 回滚的写操作的处理方式
+type RevertPolicy int
+
+const (
+	RevertKeep    RevertPolicy = iota //保留为写
+	RevertAsRead                      //降级为读
+	RevertExclude                     //去掉
+)
+
+// 当前使用的处理方式
+var revertPolicy RevertPolicy = RevertAsRead
+
+func (p RevertPolicy) String() string {
+	switch p {
+	case RevertKeep:
+		return "keep"
+	case RevertExclude:
+		return "exclude"
+	}
+	return "read"
+}
+
+func (p RevertPolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *RevertPolicy) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "keep":
+		*p = RevertKeep
+	case "read":
+		*p = RevertAsRead
+	case "exclude":
+		*p = RevertExclude
+	default:
+		return fmt.Errorf("unknown revert policy: %s", text)
+	}
+	return nil
+}
+
+// 按处理方式转换回滚的调用过程中的一次访问，返回转换后的访问方式
+func (p RevertPolicy) apply(read bool, write bool, create bool) (bool, bool, bool) {
+	switch p {
+	case RevertAsRead:
+		return read || write || create, false, false
+	case RevertExclude:
+		return read, false, false
+	}
+	return read, write, create
+}
+
+// 回滚的边的标签后缀
+const revertedSuffix = " (reverted)"
+
+// 边的标签，只来自回滚的调用过程时加上后缀
+func revertedLabel(label string, reverted bool) string {
+	if reverted {
+		return label + revertedSuffix
+	}
+	return label
+}
+
+// 去掉标签的后缀，返回原来的标签和是否回滚
+func splitRevertedLabel(label string) (string, bool) {
+	return strings.CutSuffix(label, revertedSuffix)
+}
+
+// 调用树中的调用过程自身或者祖先出错时标记为回滚，调用树完成（最外层调用结束）之后调用
+func (f *CallFrame) markReverted(parentReverted bool) {
+	f.Reverted = parentReverted || f.Error != ""
+	for _, child := range f.Children {
+		child.markReverted(f.Reverted)
+	}
+}
+
+// 交易是否失败（最外层调用出错），没有调用树时返回 false
+func txReverted(tree *CallFrame) bool {
+	return tree != nil && tree.Reverted
+}
+
+// 每个 CallQueue 项所在的调用过程是否回滚，没有调用树或者对不上时为 false
+func revertedFrames(tree *CallFrame, tx *parallel.TxInfo) []bool {
+	revertedList := make([]bool, len(tx.CallQueue))
+	for i, frame := range matchCallQueue(tree, tx.CallQueue) {
+		revertedList[i] = frame != nil && frame.Reverted
+	}
+	return revertedList
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRevertPolicyApply(t *testing.T) {
+	testList := []struct {
+		policy                          RevertPolicy
+		read, write, create             bool
+		wantRead, wantWrite, wantCreate bool
+	}{
+		{RevertKeep, false, true, false, false, true, false},
+		{RevertKeep, true, false, true, true, false, true},
+		{RevertAsRead, false, true, false, true, false, false},
+		{RevertAsRead, false, false, true, true, false, false},
+		{RevertAsRead, true, false, false, true, false, false},
+		{RevertAsRead, false, false, false, false, false, false},
+		{RevertExclude, false, true, true, false, false, false},
+		{RevertExclude, true, true, false, true, false, false},
+	}
+	for _, test := range testList {
+		read, write, create := test.policy.apply(test.read, test.write, test.create)
+		if read != test.wantRead || write != test.wantWrite || create != test.wantCreate {
+			t.Errorf("%s.apply(%v, %v, %v) = %v, %v, %v, want %v, %v, %v", test.policy, test.read, test.write, test.create,
+				read, write, create, test.wantRead, test.wantWrite, test.wantCreate)
+		}
+	}
+}
+
+func TestRevertPolicyText(t *testing.T) {
+	for _, policy := range []RevertPolicy{RevertKeep, RevertAsRead, RevertExclude} {
+		text, err := policy.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var parsed RevertPolicy
+		if err := parsed.UnmarshalText(text); err != nil {
+			t.Errorf("UnmarshalText(%q): %v", text, err)
+		}
+		if parsed != policy {
+			t.Errorf("UnmarshalText(%q) = %s, want %s", text, parsed, policy)
+		}
+	}
+	var policy RevertPolicy
+	if err := policy.UnmarshalText([]byte("drop")); err == nil {
+		t.Error("unknown revert policy should fail")
+	}
+}
+
+func TestRevertedLabel(t *testing.T) {
+	testList := []struct {
+		label    string
+		reverted bool
+		want     string
+	}{
+		{"SSTORE", false, "SSTORE"},
+		{"SSTORE", true, "SSTORE (reverted)"},
+		{"", true, " (reverted)"},
+	}
+	for _, test := range testList {
+		got := revertedLabel(test.label, test.reverted)
+		if got != test.want {
+			t.Errorf("revertedLabel(%q, %v) = %q, want %q", test.label, test.reverted, got, test.want)
+		}
+		label, reverted := splitRevertedLabel(got)
+		if label != test.label || reverted != test.reverted {
+			t.Errorf("splitRevertedLabel(%q) = %q, %v, want %q, %v", got, label, reverted, test.label, test.reverted)
+		}
+	}
+}
+
+func TestMarkReverted(t *testing.T) {
+	grandchild := &CallFrame{Depth: 2}
+	failed := &CallFrame{Depth: 1, Error: "execution reverted", Children: []*CallFrame{grandchild}}
+	ok := &CallFrame{Depth: 1}
+	root := &CallFrame{Children: []*CallFrame{failed, ok}}
+	root.markReverted(false)
+	if root.Reverted || txReverted(root) {
+		t.Error("root without error should not be reverted")
+	}
+	if !failed.Reverted || !grandchild.Reverted {
+		t.Error("failed call and its children should be reverted")
+	}
+	if ok.Reverted {
+		t.Error("sibling of a failed call should not be reverted")
+	}
+	root.Error = "out of gas"
+	root.markReverted(false)
+	if !txReverted(root) || !ok.Reverted {
+		t.Error("failed transaction should revert every call")
+	}
+	if txReverted(nil) {
+		t.Error("missing call tree should not be reverted")
+	}
+}
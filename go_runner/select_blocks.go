@@ -0,0 +1,274 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件从本地节点的数据库中按策略挑选区块，代替手工整理的 block_range.csv（rust_runner/get_block_range.ipynb）
+//输出的 CSV 第一列为区块号，其余列为元数据，ReadBlockList 和 rust_runner 都可以读取（第一行为表头）
+//运行方式: go run . select-blocks -strategy uniform -range 9800000-9900000 -n 100 -seed 1 -out ./output/selected_blocks.csv
+//默认不覆盖手工整理的 block_range.csv，其他子命令用 -blocks ./output/selected_blocks.csv 使用挑选的区块
+//--------------------------------------------------------------------------------------
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// 候选区块的元数据
+type BlockMeta struct {
+	Number    uint64
+	Hash      string
+	Time      uint64
+	GasUsed   uint64
+	GasLimit  uint64
+	TxCount   int
+	Creations int //创建合约的交易数量（不包括交易内部的 CREATE/CREATE2，需要执行才能知道）
+	Fork      string
+	txCounted bool //TxCount 和 Creations 是否已经读取（读取区块体比较慢，只在需要时读取）
+}
+
+// 读取一个区块的元数据，withTx 为 true 时读取区块体得到交易数量
+func readBlockMeta(db ethdb.Database, config *params.ChainConfig, number uint64, withTx bool) *BlockMeta {
+	hash := rawdb.ReadCanonicalHash(db, number)
+	header := rawdb.ReadHeader(db, hash, number)
+	if header == nil {
+		return nil
+	}
+	meta := &BlockMeta{
+		Number:   number,
+		Hash:     hash.Hex(),
+		Time:     header.Time,
+		GasUsed:  header.GasUsed,
+		GasLimit: header.GasLimit,
+		Fork:     forkName(config, header.Number, header.Time, header.Difficulty.Sign() == 0),
+	}
+	if withTx {
+		fillTxCount(db, meta)
+	}
+	return meta
+}
+
+// 读取区块体得到交易数量和创建合约的交易数量
+func fillTxCount(db ethdb.Database, meta *BlockMeta) {
+	if meta.txCounted {
+		return
+	}
+	body := rawdb.ReadBody(db, rawdb.ReadCanonicalHash(db, meta.Number), meta.Number)
+	if body != nil {
+		meta.TxCount = len(body.Transactions)
+		for _, tx := range body.Transactions {
+			if tx.To() == nil {
+				meta.Creations++
+			}
+		}
+	}
+	meta.txCounted = true
+}
+
+// 从候选区块中随机挑选 n 个，候选区块不足 n 个时全部返回
+func sampleUniform(candidateList []*BlockMeta, n int, rng *rand.Rand) []*BlockMeta {
+	if n >= len(candidateList) {
+		return candidateList
+	}
+	if n <= 0 {
+		return []*BlockMeta{}
+	}
+	selected := []*BlockMeta{}
+	for _, i := range rng.Perm(len(candidateList))[:n] {
+		selected = append(selected, candidateList[i])
+	}
+	return selected
+}
+
+// 分层抽样：把候选区块按 key 分成若干层，每层随机挑选 n/层数 个区块（余数分给前面的层）
+// 某一层的区块不够时全部选上，没用完的名额再平均分给还有剩余区块的层，候选区块足够时总是选出 n 个
+func sampleStratified(candidateList []*BlockMeta, n int, rng *rand.Rand, layerOf func(meta *BlockMeta) string) []*BlockMeta {
+	layerMap := make(map[string][]*BlockMeta)
+	layerNameList := []string{}
+	for _, meta := range candidateList {
+		name := layerOf(meta)
+		if _, ok := layerMap[name]; !ok {
+			layerNameList = append(layerNameList, name)
+		}
+		layerMap[name] = append(layerMap[name], meta)
+	}
+	sort.Strings(layerNameList) //层的顺序固定，保证同样的 seed 得到同样的结果
+
+	//分配每层的名额
+	quotaMap := make(map[string]int)
+	remaining := n
+	openList := layerNameList //还有剩余区块的层
+	for remaining > 0 && len(openList) > 0 {
+		share, extra := remaining/len(openList), remaining%len(openList)
+		nextList := []string{}
+		for i, name := range openList {
+			quota := share
+			if i < extra {
+				quota++
+			}
+			if capacity := len(layerMap[name]) - quotaMap[name]; quota >= capacity {
+				quota = capacity //该层的区块全部选上
+			} else {
+				nextList = append(nextList, name)
+			}
+			quotaMap[name] += quota
+			remaining -= quota
+		}
+		openList = nextList
+	}
+
+	selected := []*BlockMeta{}
+	for _, name := range layerNameList {
+		selected = append(selected, sampleUniform(layerMap[name], quotaMap[name], rng)...)
+	}
+	return selected
+}
+
+// 按数值分位数分层，返回每个区块所在的层名（层编号补零，保证排序正确）
+func quantileLayer(candidateList []*BlockMeta, strata int, value func(meta *BlockMeta) uint64) func(meta *BlockMeta) string {
+	sorted := append([]*BlockMeta{}, candidateList...)
+	sort.SliceStable(sorted, func(i, j int) bool { return value(sorted[i]) < value(sorted[j]) })
+	layer := make(map[uint64]int)
+	for i, meta := range sorted {
+		layer[meta.Number] = i * strata / len(sorted)
+	}
+	return func(meta *BlockMeta) string {
+		return fmt.Sprintf("%04d", layer[meta.Number])
+	}
+}
+
+// 按策略从候选区块 rangeList 中挑选区块
+// strategy: uniform（区间内均匀随机）, gas（按 gas used 分层）, txcount（按交易数量分层）, fork（按硬分叉分层）, top（gas used 最高的 n 个）,
+// creation（包含创建合约交易的区块中均匀随机，用于生成创建合约的测试区块集合）
+func SelectBlocks(db ethdb.Database, strategy string, rangeList []uint64, n int, strata int, seed int64) ([]*BlockMeta, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid number of blocks: %d", n)
+	}
+	if strata <= 0 {
+		return nil, fmt.Errorf("invalid number of strata: %d", strata)
+	}
+	config := readChainConfig(db)
+	rng := rand.New(rand.NewSource(seed))
+
+	//读取候选区块的元数据
+	candidateList := []*BlockMeta{}
+	for _, number := range rangeList {
+		if meta := readBlockMeta(db, config, number, strategy == "txcount" || strategy == "creation"); meta != nil {
+			candidateList = append(candidateList, meta)
+		}
+	}
+	if len(candidateList) == 0 {
+		return nil, fmt.Errorf("no block found in the candidate range")
+	}
+
+	var selected []*BlockMeta
+	switch strategy {
+	case "uniform":
+		selected = sampleUniform(candidateList, n, rng)
+	case "gas":
+		selected = sampleStratified(candidateList, n, rng, quantileLayer(candidateList, strata, func(meta *BlockMeta) uint64 { return meta.GasUsed }))
+	case "txcount":
+		selected = sampleStratified(candidateList, n, rng, quantileLayer(candidateList, strata, func(meta *BlockMeta) uint64 { return uint64(meta.TxCount) }))
+	case "fork":
+		selected = sampleStratified(candidateList, n, rng, func(meta *BlockMeta) string { return meta.Fork })
+	case "creation":
+		creationList := []*BlockMeta{}
+		for _, meta := range candidateList {
+			if meta.Creations > 0 {
+				creationList = append(creationList, meta)
+			}
+		}
+		if len(creationList) == 0 {
+			return nil, fmt.Errorf("no contract creation found in the candidate range")
+		}
+		selected = sampleUniform(creationList, n, rng)
+	case "top":
+		sort.SliceStable(candidateList, func(i, j int) bool { return candidateList[i].GasUsed > candidateList[j].GasUsed })
+		if n < len(candidateList) {
+			candidateList = candidateList[:n]
+		}
+		selected = candidateList
+	default:
+		return nil, fmt.Errorf("unknown strategy: %s", strategy)
+	}
+
+	//输出按区块号排序，并补全交易数量
+	sort.Slice(selected, func(i, j int) bool { return selected[i].Number < selected[j].Number })
+	for _, meta := range selected {
+		fillTxCount(db, meta)
+	}
+	return selected, nil
+}
+
+// CSV 的表头，第一列必须是区块号
+var blockMetaCSVHeader []string = []string{"block_number", "block_hash", "timestamp", "gas_used", "gas_limit", "tx_count", "creation_count", "fork"}
+
+// 把挑选的区块写入 CSV
+func WriteBlockMeta(path string, metaList []*BlockMeta) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	csvWriter := csv.NewWriter(file)
+	csvWriter.Write(blockMetaCSVHeader)
+	for _, meta := range metaList {
+		csvWriter.Write([]string{
+			strconv.FormatUint(meta.Number, 10),
+			meta.Hash,
+			strconv.FormatUint(meta.Time, 10),
+			strconv.FormatUint(meta.GasUsed, 10),
+			strconv.FormatUint(meta.GasLimit, 10),
+			strconv.Itoa(meta.TxCount),
+			strconv.Itoa(meta.Creations),
+			meta.Fork,
+		})
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// select-blocks 子命令
+func SelectBlocksCommand(args []string) {
+	flagSet := flag.NewFlagSet("select-blocks", flag.ExitOnError)
+	strategy := flagSet.String("strategy", "uniform", "sampling strategy: uniform, gas, txcount, fork, top or creation")
+	rangeSpec := flagSet.String("range", "9800000-9900000", "candidate block set, see block_set.go")
+	n := flagSet.Int("n", 100, "number of blocks to select")
+	strata := flagSet.Int("strata", 10, "number of strata for the gas and txcount strategies")
+	seed := flagSet.Int64("seed", 1, "random seed")
+	outFile := flagSet.String("out", "./output/selected_blocks.csv", "output CSV file")
+	chainFlags(flagSet)
+	logFlags(flagSet)
+	flagSet.Parse(args)
+
+	db, err := openChainDB()
+	if err != nil {
+		logger.Error("open rawdb fail", "err", err)
+		return
+	}
+	defer db.Close()
+
+	rangeList, err := ParseBlockSet(*rangeSpec, db)
+	if err != nil {
+		logger.Error("parse block set fail", "err", err)
+		return
+	}
+	selected, err := SelectBlocks(db, *strategy, rangeList, *n, *strata, *seed)
+	if err != nil {
+		logger.Error("select blocks fail", "err", err)
+		return
+	}
+	if err := WriteBlockMeta(*outFile, selected); err != nil {
+		logger.Error("write block list fail", "err", err)
+		return
+	}
+	logger.Info("selected blocks", "count", len(selected), "file", *outFile)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// 构造区块号为 start 到 start+count-1 的候选区块，gas used 等于区块号
+func testBlockMetaList(start uint64, count int) []*BlockMeta {
+	metaList := []*BlockMeta{}
+	for i := 0; i < count; i++ {
+		metaList = append(metaList, &BlockMeta{Number: start + uint64(i), GasUsed: start + uint64(i)})
+	}
+	return metaList
+}
+
+// 检查挑选的区块没有重复
+func checkDistinct(t *testing.T, name string, selected []*BlockMeta) {
+	t.Helper()
+	seen := make(map[uint64]bool)
+	for _, meta := range selected {
+		if seen[meta.Number] {
+			t.Errorf("%s: block %d selected twice", name, meta.Number)
+		}
+		seen[meta.Number] = true
+	}
+}
+
+func TestSampleUniform(t *testing.T) {
+	candidateList := testBlockMetaList(100, 10)
+	for _, test := range []struct{ n, want int }{{3, 3}, {10, 10}, {20, 10}, {0, 0}, {-1, 0}} {
+		selected := sampleUniform(candidateList, test.n, rand.New(rand.NewSource(1)))
+		if len(selected) != test.want {
+			t.Errorf("n=%d: selected %d blocks, want %d", test.n, len(selected), test.want)
+		}
+		checkDistinct(t, fmt.Sprint("n=", test.n), selected)
+	}
+}
+
+func TestSampleStratified(t *testing.T) {
+	//层 a 只有 1 个区块，层 b 有 2 个，层 c 有 20 个
+	candidateList := append(append(testBlockMetaList(100, 1), testBlockMetaList(200, 2)...), testBlockMetaList(300, 20)...)
+	layerOf := func(meta *BlockMeta) string { return map[uint64]string{1: "a", 2: "b", 3: "c"}[meta.Number/100] }
+	testList := []struct {
+		n    int
+		want map[string]int
+	}{
+		{3, map[string]int{"a": 1, "b": 1, "c": 1}},
+		{9, map[string]int{"a": 1, "b": 2, "c": 6}},
+		{10, map[string]int{"a": 1, "b": 2, "c": 7}},
+		{23, map[string]int{"a": 1, "b": 2, "c": 20}},
+		{50, map[string]int{"a": 1, "b": 2, "c": 20}},
+		{2, map[string]int{"a": 1, "b": 1}},
+	}
+	for _, test := range testList {
+		selected := sampleStratified(candidateList, test.n, rand.New(rand.NewSource(1)), layerOf)
+		got := make(map[string]int)
+		for _, meta := range selected {
+			got[layerOf(meta)]++
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("n=%d: selected per layer %v, want %v", test.n, got, test.want)
+		}
+		checkDistinct(t, fmt.Sprint("n=", test.n), selected)
+	}
+}
+
+func TestSampleStratifiedSeed(t *testing.T) {
+	candidateList := testBlockMetaList(1000, 100)
+	layerOf := quantileLayer(candidateList, 4, func(meta *BlockMeta) uint64 { return meta.GasUsed })
+	first := sampleStratified(candidateList, 10, rand.New(rand.NewSource(7)), layerOf)
+	second := sampleStratified(candidateList, 10, rand.New(rand.NewSource(7)), layerOf)
+	if fmt.Sprint(first) != fmt.Sprint(second) {
+		t.Error("same seed should select the same blocks")
+	}
+}
+
+func TestSelectBlocksInvalid(t *testing.T) {
+	for _, test := range []struct{ n, strata int }{{0, 10}, {-1, 10}, {10, 0}} {
+		if _, err := SelectBlocks(nil, "uniform", []uint64{1, 2, 3}, test.n, test.strata, 1); err == nil {
+			t.Errorf("n=%d strata=%d: want error", test.n, test.strata)
+		}
+	}
+}
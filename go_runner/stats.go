@@ -0,0 +1,60 @@
+package main
+
+// 一组加速比等数值的统计信息
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// 数值的统计信息
+type Stats struct {
+	Count  int
+	Min    float64
+	Median float64
+	Max    float64
+	Mean   float64
+	StdDev float64 //总体标准差
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("count=%d min=%.4f median=%.4f max=%.4f mean=%.4f stddev=%.4f", s.Count, s.Min, s.Median, s.Max, s.Mean, s.StdDev)
+}
+
+// 平均值，没有数据时为 NaN
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// 计算最小值、中位数、最大值、平均值和标准差，没有数据时都为 NaN
+func summarize(values []float64) Stats {
+	s := Stats{Count: len(values)}
+	if len(values) == 0 {
+		nan := math.NaN()
+		s.Min, s.Median, s.Max, s.Mean, s.StdDev = nan, nan, nan, nan, nan
+		return s
+	}
+
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	s.Min = sorted[0]
+	s.Max = sorted[len(sorted)-1]
+	if len(sorted)%2 == 1 {
+		s.Median = sorted[len(sorted)/2]
+	} else {
+		s.Median = (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+	}
+
+	s.Mean = mean(values)
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - s.Mean) * (v - s.Mean)
+	}
+	s.StdDev = math.Sqrt(variance / float64(len(values)))
+	return s
+}
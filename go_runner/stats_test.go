@@ -0,0 +1,60 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	testList := []struct {
+		name   string
+		values []float64
+		want   Stats
+	}{
+		{"single", []float64{2}, Stats{Count: 1, Min: 2, Median: 2, Max: 2, Mean: 2, StdDev: 0}},
+		{"odd", []float64{3, 1, 2}, Stats{Count: 3, Min: 1, Median: 2, Max: 3, Mean: 2, StdDev: math.Sqrt(2.0 / 3)}},
+		{"even", []float64{4, 1, 3, 2}, Stats{Count: 4, Min: 1, Median: 2.5, Max: 4, Mean: 2.5, StdDev: math.Sqrt(1.25)}},
+		{"constant", []float64{5, 5, 5, 5}, Stats{Count: 4, Min: 5, Median: 5, Max: 5, Mean: 5, StdDev: 0}},
+	}
+	for _, test := range testList {
+		got := summarize(test.values)
+		if got.Count != test.want.Count {
+			t.Errorf("%s: count = %d, want %d", test.name, got.Count, test.want.Count)
+		}
+		for _, field := range []struct {
+			name      string
+			got, want float64
+		}{
+			{"min", got.Min, test.want.Min},
+			{"median", got.Median, test.want.Median},
+			{"max", got.Max, test.want.Max},
+			{"mean", got.Mean, test.want.Mean},
+			{"stddev", got.StdDev, test.want.StdDev},
+		} {
+			if math.Abs(field.got-field.want) > 1e-9 {
+				t.Errorf("%s: %s = %v, want %v", test.name, field.name, field.got, field.want)
+			}
+		}
+	}
+}
+
+func TestSummarizeEmpty(t *testing.T) {
+	got := summarize(nil)
+	if got.Count != 0 {
+		t.Errorf("count = %d, want 0", got.Count)
+	}
+	for _, value := range []float64{got.Min, got.Median, got.Max, got.Mean, got.StdDev} {
+		if !math.IsNaN(value) {
+			t.Errorf("empty stats = %v, want all NaN", got)
+			break
+		}
+	}
+}
+
+func TestSummarizeKeepsInput(t *testing.T) {
+	values := []float64{3, 1, 2}
+	summarize(values)
+	if values[0] != 3 || values[1] != 1 || values[2] != 2 {
+		t.Errorf("summarize reordered its input: %v", values)
+	}
+}
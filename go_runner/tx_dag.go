@@ -0,0 +1,422 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件根据交易的读写集合（access_set.go）生成 Transaction 之间的依赖图（DAG）
+//边 i->j 表示交易 j 必须在交易 i 之后执行，边上标注每个冲突账户以及它的冲突类型（RAW/WAW/WAR）
+//冲突只到账户级别，不标注存储槽：读写集合和 speedup、cluster 的冲突模型都是账户级别的，
+//同一合约不同存储槽的读写也算冲突，按存储槽标注会和这些分析得到的依赖关系不一致
+//依赖图可以导出为 GraphML、GEXF 和 DOT 格式，方便用 Gephi、NetworkX 等工具分析
+//运行方式: go run . dag -blocks 9833300 [-format all] [-out ./output]
+//--------------------------------------------------------------------------------------
+
+import (
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/parallel"
+)
+
+// 冲突类型
+const (
+	ConflictRAW = "RAW" //写后读：前面的交易写，后面的交易读
+	ConflictWAW = "WAW" //写后写：前后两笔交易都写
+	ConflictWAR = "WAR" //读后写：前面的交易读，后面的交易写
+)
+
+// 依赖图的节点（一笔交易）
+type TxDAGNode struct {
+	ID      int
+	TxHash  string
+	From    string
+	To      string
+	GasUsed uint64
+}
+
+// 一个账户上的冲突
+type TxDAGConflict struct {
+	Account string
+	Kinds   []string //该账户上的冲突类型（按 RAW、WAW、WAR 的顺序）
+}
+
+// 冲突的标签, 例如 "0xabc...:RAW,WAW"
+func (c TxDAGConflict) Label() string {
+	return c.Account + ":" + strings.Join(c.Kinds, ",")
+}
+
+// 依赖图的边，一对交易之间只有一条边，每个冲突的账户和它的冲突类型都记录在边上
+type TxDAGEdge struct {
+	From      int
+	To        int
+	Conflicts []TxDAGConflict //按照交易 From 访问账户的顺序
+}
+
+// 边上所有账户的冲突类型（去重并排序），用于按类型筛选边
+func (e *TxDAGEdge) Kinds() []string {
+	kindMap := make(map[string]bool)
+	for _, conflict := range e.Conflicts {
+		for _, kind := range conflict.Kinds {
+			kindMap[kind] = true
+		}
+	}
+	kinds := []string{}
+	for kind := range kindMap {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// 边的标签, 每个账户一项，例如 "0xabc...:RAW,WAW 0xdef...:WAR"
+func (e *TxDAGEdge) Label() string {
+	labelList := []string{}
+	for _, conflict := range e.Conflicts {
+		labelList = append(labelList, conflict.Label())
+	}
+	return strings.Join(labelList, " ")
+}
+
+// Transaction 之间的依赖图
+type TxDAG struct {
+	BlockNumber uint64
+	NodeList    []TxDAGNode
+	EdgeList    []TxDAGEdge
+}
+
+// 判断两笔交易在一个账户上的冲突类型，a 在 b 之前执行，创建也算作写
+func conflictKinds(a *AccountAccess, b *AccountAccess) []string {
+	aWrite := a.Write || a.Create
+	bWrite := b.Write || b.Create
+	kinds := []string{}
+	if aWrite && b.Read {
+		kinds = append(kinds, ConflictRAW)
+	}
+	if aWrite && bWrite {
+		kinds = append(kinds, ConflictWAW)
+	}
+	if a.Read && bWrite {
+		kinds = append(kinds, ConflictWAR)
+	}
+	return kinds
+}
+
+// 根据读写集合生成依赖图，receipts 用于获得每笔交易消耗的 gas
+func BuildTxDAG(blockNumber uint64, blockInfo *parallel.BlockInfo, setList []*TxAccessSet, receipts types.Receipts) *TxDAG {
+	dag := &TxDAG{BlockNumber: blockNumber}
+	weights := gasWeights(receipts)
+	for i, tx := range blockInfo.Tx {
+		node := TxDAGNode{ID: i, TxHash: tx.TxHash.Hex(), From: tx.From.Hex(), To: txToLabel(tx)}
+		if i < len(weights) {
+			node.GasUsed = weights[i]
+		}
+		dag.NodeList = append(dag.NodeList, node)
+	}
+
+	for j := range setList {
+		for i := 0; i < j; i++ {
+			edge := TxDAGEdge{From: i, To: j}
+			for _, addr := range setList[i].Order { //按照访问顺序遍历，保证输出稳定
+				b, ok := setList[j].Accounts[addr]
+				if !ok {
+					continue
+				}
+				kinds := conflictKinds(setList[i].Accounts[addr], b)
+				if len(kinds) == 0 {
+					continue
+				}
+				edge.Conflicts = append(edge.Conflicts, TxDAGConflict{Account: addr, Kinds: kinds})
+			}
+			if len(edge.Conflicts) == 0 {
+				continue
+			}
+			dag.EdgeList = append(dag.EdgeList, edge)
+		}
+	}
+	return dag
+}
+
+// 导出为 DOT 格式，使用 graph_utils.go 中的 Graph
+func (dag *TxDAG) toDOT() string {
+	graph := Graph{GraphName: "TxDAG"}
+	graph.GraphAttr = append(graph.GraphAttr, "rankdir = \"LR\"")
+	for _, n := range dag.NodeList {
+		node := Node{NodeName: fmt.Sprintf("tx%d", n.ID)}
+		node.AddAttr("shape", "box")
+		node.AddAttr("label", fmt.Sprintf("Tx_%d\\n%s\\ngas: %d", n.ID, n.TxHash, n.GasUsed))
+		graph.AddNode(node)
+	}
+	for _, e := range dag.EdgeList {
+		edge := Edge{From: fmt.Sprintf("tx%d", e.From), To: fmt.Sprintf("tx%d", e.To), lineType: "->"}
+		edge.AddAttr("label", e.Label())
+		graph.AddEdge(edge)
+	}
+	return graph.toDOT()
+}
+
+// GraphML 格式的 XML 结构
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	NodeList    []graphMLNode `xml:"node"`
+	EdgeList    []graphMLEdge `xml:"edge"`
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	KeyList []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+// 导出为 GraphML 格式
+func (dag *TxDAG) toGraphML() ([]byte, error) {
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		KeyList: []graphMLKey{
+			{ID: "tx_hash", For: "node", AttrName: "tx_hash", AttrType: "string"},
+			{ID: "from", For: "node", AttrName: "from", AttrType: "string"},
+			{ID: "to", For: "node", AttrName: "to", AttrType: "string"},
+			{ID: "gas_used", For: "node", AttrName: "gas_used", AttrType: "long"},
+			{ID: "kind", For: "edge", AttrName: "kind", AttrType: "string"},
+			{ID: "label", For: "edge", AttrName: "label", AttrType: "string"},
+		},
+		Graph: graphMLGraph{ID: fmt.Sprintf("block_%d", dag.BlockNumber), EdgeDefault: "directed"},
+	}
+	for _, n := range dag.NodeList {
+		doc.Graph.NodeList = append(doc.Graph.NodeList, graphMLNode{
+			ID: fmt.Sprintf("tx%d", n.ID),
+			Data: []graphMLData{
+				{Key: "tx_hash", Value: n.TxHash},
+				{Key: "from", Value: n.From},
+				{Key: "to", Value: n.To},
+				{Key: "gas_used", Value: fmt.Sprint(n.GasUsed)},
+			},
+		})
+	}
+	for i, e := range dag.EdgeList {
+		doc.Graph.EdgeList = append(doc.Graph.EdgeList, graphMLEdge{
+			ID:     fmt.Sprintf("e%d", i),
+			Source: fmt.Sprintf("tx%d", e.From),
+			Target: fmt.Sprintf("tx%d", e.To),
+			Data: []graphMLData{
+				{Key: "kind", Value: strings.Join(e.Kinds(), ",")},
+				{Key: "label", Value: e.Label()},
+			},
+		})
+	}
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// GEXF 格式的 XML 结构
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfAttributes struct {
+	Class         string          `xml:"class,attr"`
+	AttributeList []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type gexfNode struct {
+	ID        string         `xml:"id,attr"`
+	Label     string         `xml:"label,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfEdge struct {
+	ID        string         `xml:"id,attr"`
+	Source    string         `xml:"source,attr"`
+	Target    string         `xml:"target,attr"`
+	Label     string         `xml:"label,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfGraph struct {
+	DefaultEdgeType string           `xml:"defaultedgetype,attr"`
+	Attributes      []gexfAttributes `xml:"attributes"`
+	NodeList        []gexfNode       `xml:"nodes>node"`
+	EdgeList        []gexfEdge       `xml:"edges>edge"`
+}
+
+type gexf struct {
+	XMLName xml.Name  `xml:"gexf"`
+	XMLNS   string    `xml:"xmlns,attr"`
+	Version string    `xml:"version,attr"`
+	Graph   gexfGraph `xml:"graph"`
+}
+
+// 导出为 GEXF 格式
+func (dag *TxDAG) toGEXF() ([]byte, error) {
+	doc := gexf{
+		XMLNS:   "http://gexf.net/1.3",
+		Version: "1.3",
+		Graph: gexfGraph{
+			DefaultEdgeType: "directed",
+			Attributes: []gexfAttributes{
+				{Class: "node", AttributeList: []gexfAttribute{
+					{ID: "tx_hash", Title: "tx_hash", Type: "string"},
+					{ID: "from", Title: "from", Type: "string"},
+					{ID: "to", Title: "to", Type: "string"},
+					{ID: "gas_used", Title: "gas_used", Type: "long"},
+				}},
+				{Class: "edge", AttributeList: []gexfAttribute{
+					{ID: "kind", Title: "kind", Type: "string"},
+				}},
+			},
+		},
+	}
+	for _, n := range dag.NodeList {
+		doc.Graph.NodeList = append(doc.Graph.NodeList, gexfNode{
+			ID:    fmt.Sprintf("tx%d", n.ID),
+			Label: fmt.Sprintf("Tx_%d", n.ID),
+			AttValues: []gexfAttValue{
+				{For: "tx_hash", Value: n.TxHash},
+				{For: "from", Value: n.From},
+				{For: "to", Value: n.To},
+				{For: "gas_used", Value: fmt.Sprint(n.GasUsed)},
+			},
+		})
+	}
+	for i, e := range dag.EdgeList {
+		doc.Graph.EdgeList = append(doc.Graph.EdgeList, gexfEdge{
+			ID:     fmt.Sprintf("e%d", i),
+			Source: fmt.Sprintf("tx%d", e.From),
+			Target: fmt.Sprintf("tx%d", e.To),
+			Label:  e.Label(),
+			AttValues: []gexfAttValue{
+				{For: "kind", Value: strings.Join(e.Kinds(), ",")},
+			},
+		})
+	}
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// 按照指定格式（graphml、gexf、dot 或 all）把依赖图写入 path 目录
+func (dag *TxDAG) Output(path string, fileName string, format string) error {
+	formatList := []string{format}
+	if format == "all" {
+		formatList = []string{"graphml", "gexf", "dot"}
+	}
+	for _, f := range formatList {
+		var data []byte
+		var err error
+		var filePath string
+		switch f {
+		case "graphml":
+			data, err = dag.toGraphML()
+			filePath = path + "/" + fileName + ".graphml"
+		case "gexf":
+			data, err = dag.toGEXF()
+			filePath = path + "/" + fileName + ".gexf"
+		case "dot":
+			data = []byte(dag.toDOT())
+			filePath = path + "/" + fileName + ".gv"
+		default:
+			return fmt.Errorf("unknown graph format: %s", f)
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filePath, data, 0644); err != nil {
+			return err
+		}
+		logger.Info("output file", "path", filePath)
+	}
+	return nil
+}
+
+// dag 子命令：执行 -blocks 指定的区块并导出每个区块 Transaction 之间的依赖图
+func DAGCommand(args []string) {
+	flagSet := flag.NewFlagSet("dag", flag.ExitOnError)
+	blockSpec := flagSet.String("blocks", "9833300", "block set, see block_set.go")
+	format := flagSet.String("format", "all", "output format: graphml, gexf, dot or all")
+	outDir := flagSet.String("out", "./output", "output directory")
+	coinbase := flagSet.Bool("coinbase", false, "count the fee payment to coinbase as a conflict")
+	sender := flagSet.Bool("sender", true, "count the sender nonce and fee deduction as a conflict")
+	openCheckpoint := checkpointFlags(flagSet, "dag")
+	progressFlags(flagSet)
+	validateFlags(flagSet)
+	callContextFlags(flagSet)
+	chainFlags(flagSet)
+	logFlags(flagSet)
+	flagSet.Parse(args)
+
+	blockList, err := loadBlockSet(*blockSpec)
+	if err != nil {
+		logger.Error("parse block set fail", "err", err)
+		return
+	}
+	checkpoint, err := openCheckpoint()
+	if err != nil {
+		logger.Error("open checkpoint fail", "err", err)
+		return
+	}
+	model := ConflictModel{IncludeCoinbase: *coinbase, IncludeSender: *sender}
+
+	//每个区块输出一个文件
+	remaining := checkpoint.Remaining(blockList)
+	progress := NewProgress(len(remaining))
+	for _, blockNumber := range remaining {
+		block, receipts, err := DoProcess(blockNumber)
+		if err != nil {
+			progress.Add(0, true)
+			continue
+		}
+		setList := BuildAccessSets(parallel.GetBlockInfo(), block.Coinbase(), model)
+		dag := BuildTxDAG(blockNumber, parallel.GetBlockInfo(), setList, receipts)
+
+		err = dag.Output(*outDir, fmt.Sprintf("TxDAG_%d", blockNumber), *format)
+		if err != nil {
+			logger.Error("output dag fail", "block", blockNumber, "err", err)
+			progress.Add(block.GasUsed(), true)
+			continue
+		}
+		if err := checkpoint.Save(blockNumber, nil); err != nil {
+			logger.Warn("save checkpoint fail", "block", blockNumber, "err", err)
+		}
+		progress.Add(block.GasUsed(), false)
+	}
+}
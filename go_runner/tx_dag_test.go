@@ -0,0 +1,108 @@
+package main
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/parallel"
+)
+
+func TestConflictKinds(t *testing.T) {
+	testList := []struct {
+		name string
+		a    AccountAccess
+		b    AccountAccess
+		want []string
+	}{
+		{"read read", AccountAccess{Read: true}, AccountAccess{Read: true}, []string{}},
+		{"write read", AccountAccess{Write: true}, AccountAccess{Read: true}, []string{ConflictRAW}},
+		{"write write", AccountAccess{Write: true}, AccountAccess{Write: true}, []string{ConflictWAW}},
+		{"read write", AccountAccess{Read: true}, AccountAccess{Write: true}, []string{ConflictWAR}},
+		{"create read", AccountAccess{Create: true}, AccountAccess{Read: true}, []string{ConflictRAW}},
+		{"readwrite readwrite", AccountAccess{Read: true, Write: true}, AccountAccess{Read: true, Write: true}, []string{ConflictRAW, ConflictWAW, ConflictWAR}},
+	}
+	for _, test := range testList {
+		if got := conflictKinds(&test.a, &test.b); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: conflictKinds = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestBuildTxDAG(t *testing.T) {
+	const a, b = "0x000000000000000000000000000000000000aaaa", "0x000000000000000000000000000000000000bbbb"
+	blockInfo := &parallel.BlockInfo{}
+	for i := 0; i < 4; i++ {
+		blockInfo.Tx = append(blockInfo.Tx, &parallel.TxInfo{TxHash: common.BigToHash(big.NewInt(int64(i))), To: a, Value: big.NewInt(0)})
+	}
+	setList := []*TxAccessSet{
+		testAccessSet(0, map[string]string{a: "w"}),
+		testAccessSet(1, map[string]string{a: "r"}),
+		testAccessSet(2, map[string]string{a: "rw", b: "w"}),
+		testAccessSet(3, map[string]string{b: "r"}),
+	}
+	dag := BuildTxDAG(1, blockInfo, setList, nil)
+	if len(dag.NodeList) != 4 {
+		t.Fatalf("nodes = %d, want 4", len(dag.NodeList))
+	}
+
+	type edgeKey struct{ from, to int }
+	got := make(map[edgeKey]string)
+	for _, edge := range dag.EdgeList {
+		got[edgeKey{edge.From, edge.To}] = edge.Label()
+	}
+	want := map[edgeKey]string{
+		{0, 1}: common.HexToAddress(a).Hex() + ":RAW",
+		{0, 2}: common.HexToAddress(a).Hex() + ":RAW,WAW",
+		{1, 2}: common.HexToAddress(a).Hex() + ":WAR",
+		{2, 3}: common.HexToAddress(b).Hex() + ":RAW",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("edges = %v, want %v", got, want)
+	}
+	for _, edge := range dag.EdgeList {
+		if edge.From >= edge.To {
+			t.Errorf("edge %d -> %d does not follow block order", edge.From, edge.To)
+		}
+	}
+}
+
+// 一条边上不同账户的冲突类型分别标注，不合并
+func TestBuildTxDAGPerAccountKinds(t *testing.T) {
+	a, b := common.HexToAddress("0xaaaa").Hex(), common.HexToAddress("0xbbbb").Hex()
+	blockInfo := &parallel.BlockInfo{}
+	for i := 0; i < 2; i++ {
+		blockInfo.Tx = append(blockInfo.Tx, &parallel.TxInfo{TxHash: common.BigToHash(big.NewInt(int64(i))), To: a, Value: big.NewInt(0)})
+	}
+	//交易 0 先访问 a 再访问 b，边上的冲突按这个顺序排列
+	first := &TxAccessSet{TxIndex: 0, Accounts: make(map[string]*AccountAccess)}
+	first.add(a, false, true, false)
+	first.add(b, true, false, false)
+	setList := []*TxAccessSet{first, testAccessSet(1, map[string]string{a: "r", b: "w"})}
+	dag := BuildTxDAG(1, blockInfo, setList, nil)
+	if len(dag.EdgeList) != 1 {
+		t.Fatalf("edges = %d, want 1", len(dag.EdgeList))
+	}
+	edge := dag.EdgeList[0]
+	want := []TxDAGConflict{{Account: a, Kinds: []string{ConflictRAW}}, {Account: b, Kinds: []string{ConflictWAR}}}
+	if !reflect.DeepEqual(edge.Conflicts, want) {
+		t.Errorf("conflicts = %v, want %v", edge.Conflicts, want)
+	}
+	if got := edge.Label(); got != a+":RAW "+b+":WAR" {
+		t.Errorf("label = %q", got)
+	}
+	if got := edge.Kinds(); !reflect.DeepEqual(got, []string{ConflictRAW, ConflictWAR}) {
+		t.Errorf("kinds = %v", got)
+	}
+
+	//导出的 GraphML 中边的标签按账户区分冲突类型
+	data, err := dag.toGraphML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), a+":RAW "+b+":WAR") {
+		t.Errorf("graphml does not contain per-account label:\n%s", data)
+	}
+}
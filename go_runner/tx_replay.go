@@ -0,0 +1,365 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件提供 replay-tx 子命令：单独执行区块中的一笔交易，用于分析区块报告中表现异常的交易
+//先从父区块的状态开始依次执行它前面的交易，再用 EVMLogger 执行这笔交易，得到每个 opcode 的执行次数、时间和 gas
+//KeyOpcode 和 CallQueue 来自 Hook，直接读取这笔交易执行（ApplyTransaction）时 Hook 记录的数据，不再执行整个区块
+//插桩的 geth 只在 Process 中记录 Hook 数据时读取不到，此时才再执行一次整个区块（输出 warn 日志，大区块会慢很多）
+//EVMLogger 同时记录每个调用过程的类型、value、gas 和时间，与 CallQueue 合并为调用树（见 call_tree.go）
+//运行方式: go run . replay-tx 0x<交易 Hash>      或者      go run . replay-tx 9833300:12（区块号:交易序号）
+//--------------------------------------------------------------------------------------
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/parallel"
+)
+
+// 统计每个 opcode 的执行次数、时间和 gas 的 EVMLogger，同时记录调用树
+type opcodeTracer struct {
+	statMap  map[vm.OpCode]*OpcodeStat
+	lastOp   vm.OpCode
+	lastTime time.Time
+	running  bool
+
+	callFrameRecorder
+}
+
+// 保证 opcodeTracer 实现了 EVMLogger
+var _ vm.EVMLogger = (*opcodeTracer)(nil)
+
+func newOpcodeTracer() *opcodeTracer {
+	return &opcodeTracer{statMap: make(map[vm.OpCode]*OpcodeStat)}
+}
+
+// 把从上一个 opcode 开始到现在的时间算到上一个 opcode 上
+func (t *opcodeTracer) closeLastOp(now time.Time) {
+	if t.running {
+		t.statMap[t.lastOp].TimeNs += now.Sub(t.lastTime).Nanoseconds()
+		t.running = false
+	}
+}
+
+func (t *opcodeTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	now := time.Now()
+	t.closeLastOp(now)
+	stat, ok := t.statMap[op]
+	if !ok {
+		stat = &OpcodeStat{Opcode: op.String(), Category: opcodeCategory(op)}
+		t.statMap[op] = stat
+	}
+	stat.Count++
+	stat.Gas += cost
+	t.recordAccountRead(op, scope)
+	t.lastOp, t.lastTime, t.running = op, now, true
+}
+
+func (t *opcodeTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.precompiles = activePrecompiles(env)
+	typ := "CALL"
+	if create {
+		typ = "CREATE"
+	}
+	t.enterFrame(typ, from, to, value)
+}
+
+func (t *opcodeTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {
+	t.closeLastOp(time.Now())
+	t.exitFrame(gasUsed, err)
+}
+
+func (t *opcodeTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	t.enterFrame(typ.String(), from, to, value)
+}
+
+func (t *opcodeTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	t.exitFrame(gasUsed, err)
+}
+
+func (t *opcodeTracer) CaptureTxStart(gasLimit uint64) {}
+func (t *opcodeTracer) CaptureTxEnd(restGas uint64)    {}
+func (t *opcodeTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+// 按时间从大到小排序的 opcode 统计
+func (t *opcodeTracer) stats() []OpcodeStat {
+	statList := make([]OpcodeStat, 0, len(t.statMap))
+	for _, stat := range t.statMap {
+		statList = append(statList, *stat)
+	}
+	sort.Slice(statList, func(i, j int) bool {
+		if statList[i].TimeNs != statList[j].TimeNs {
+			return statList[i].TimeNs > statList[j].TimeNs
+		}
+		return statList[i].Opcode < statList[j].Opcode
+	})
+	return statList
+}
+
+// 单笔交易的执行结果
+type TxReplay struct {
+	BlockNumber uint64               `json:"block_number"`
+	TxIndex     int                  `json:"tx_index"`
+	TxHash      string               `json:"tx_hash"`
+	From        string               `json:"from"`
+	To          *common.Address      `json:"to"` //创建合约的交易为 null
+	NewContract *common.Address      `json:"new_contract_addr,omitempty"`
+	Value       string               `json:"value"`
+	GasUsed     uint64               `json:"gas_used"`
+	Status      uint64               `json:"status"`
+	ExecTimeNs  int64                `json:"exec_time_ns"`
+	Type        uint8                `json:"type"` //交易类型，3 为 blob 交易
+	BlobHashes  int                  `json:"blob_hashes,omitempty"`
+	BlobGasUsed uint64               `json:"blob_gas_used,omitempty"`
+	Opcodes     []OpcodeStat         `json:"opcodes"`
+	Categories  []OpcodeCategoryStat `json:"opcode_categories"`
+	Precompiles []PrecompileStat     `json:"precompiles"` //预编译合约的时间包括在调用它的 CALL/STATICCALL 的时间中
+	CallQueue   []*parallel.CallInfo `json:"call_queue"`
+	CallTree    *CallFrame           `json:"call_tree"`
+}
+
+// 解析 replay-tx 的参数：交易 Hash 或者 "区块号:交易序号"
+func resolveTx(db ethdb.Database, spec string) (uint64, int, error) {
+	if blockPart, indexPart, ok := strings.Cut(spec, ":"); ok {
+		blockNumber, err1 := strconv.ParseUint(blockPart, 10, 64)
+		index, err2 := strconv.Atoi(indexPart)
+		if err1 != nil || err2 != nil || index < 0 {
+			return 0, 0, fmt.Errorf("invalid transaction: %s", spec)
+		}
+		return blockNumber, index, nil
+	}
+	if strings.HasPrefix(spec, "0x") && len(spec) == 66 {
+		tx, _, blockNumber, index := rawdb.ReadTransaction(db, common.HexToHash(spec))
+		if tx == nil {
+			return 0, 0, fmt.Errorf("transaction not found (is the tx index complete?): %s", spec)
+		}
+		return blockNumber, int(index), nil
+	}
+	return 0, 0, fmt.Errorf("invalid transaction: %s", spec)
+}
+
+// 执行区块 blockNumber 中序号为 index 的交易
+func ReplayTx(db ethdb.Database, bc *core.BlockChain, blockNumber uint64, index int) (*TxReplay, error) {
+	block := rawdb.ReadBlock(db, rawdb.ReadCanonicalHash(db, blockNumber), blockNumber)
+	parentBlock := rawdb.ReadBlock(db, rawdb.ReadCanonicalHash(db, blockNumber-1), blockNumber-1)
+	if block == nil || parentBlock == nil {
+		return nil, errBlockMissing
+	}
+	txList := block.Transactions()
+	if index >= len(txList) {
+		return nil, fmt.Errorf("block %d has %d transactions, index %d out of range", blockNumber, len(txList), index)
+	}
+	stateDb, err := bc.StateAt(parentBlock.Root())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errStateMissing, err)
+	}
+
+	//与 StateProcessor.Process 一样，先处理硬分叉和 beacon root，再依次执行前面的交易
+	config := bc.Config()
+	header := block.Header()
+	if config.DAOForkSupport && config.DAOForkBlock != nil && config.DAOForkBlock.Cmp(block.Number()) == 0 {
+		misc.ApplyDAOHardFork(stateDb)
+	}
+	if beaconRoot := block.BeaconRoot(); beaconRoot != nil {
+		vmenv := vm.NewEVM(core.NewEVMBlockContext(header, bc, nil), vm.TxContext{}, stateDb, config, vm.Config{})
+		core.ProcessBeaconBlockRoot(*beaconRoot, vmenv, stateDb)
+	}
+	gasPool := new(core.GasPool).AddGas(block.GasLimit())
+	usedGas := new(uint64)
+	//执行交易时插桩的 geth 写入全局的 Hook 数据，执行和读取 Hook 数据都要在锁内完成
+	hookLock.Lock()
+	defer hookLock.Unlock()
+	for i, tx := range txList[:index] {
+		stateDb.SetTxContext(tx.Hash(), i)
+		if _, err := core.ApplyTransaction(config, bc, nil, gasPool, stateDb, header, tx, usedGas, vm.Config{}); err != nil {
+			return nil, fmt.Errorf("%w: apply tx %d: %v", errReplay, i, err)
+		}
+	}
+
+	//执行这笔交易
+	tx := txList[index]
+	tracer := newOpcodeTracer()
+	stateDb.SetTxContext(tx.Hash(), index)
+	startTime := time.Now()
+	receipt, err := core.ApplyTransaction(config, bc, nil, gasPool, stateDb, header, tx, usedGas, vm.Config{Tracer: tracer})
+	execTime := time.Since(startTime)
+	if err != nil {
+		return nil, fmt.Errorf("%w: apply tx %d: %v", errReplay, index, err)
+	}
+
+	from, _ := types.Sender(types.MakeSigner(config, header.Number, header.Time), tx)
+	replay := &TxReplay{
+		BlockNumber: blockNumber,
+		TxIndex:     index,
+		TxHash:      tx.Hash().Hex(),
+		From:        from.Hex(),
+		To:          tx.To(),
+		Value:       tx.Value().String(),
+		GasUsed:     receipt.GasUsed,
+		Status:      receipt.Status,
+		ExecTimeNs:  execTime.Nanoseconds(),
+		Type:        tx.Type(),
+		BlobHashes:  len(tx.BlobHashes()),
+		BlobGasUsed: receipt.BlobGasUsed,
+		Opcodes:     tracer.stats(),
+		CallTree:    tracer.root,
+		Precompiles: precompileStats(tracer.root),
+	}
+	if tx.To() == nil {
+		replay.NewContract = &receipt.ContractAddress
+	}
+	replay.Categories = opcodeCategoryStats(replay.Opcodes)
+
+	//读取这笔交易执行时 Hook 记录的数据，读取不到时才执行整个区块
+	txInfo := hookTxInfo(tx.Hash())
+	if txInfo == nil {
+		logger.Warn("hook data not recorded by ApplyTransaction, replaying the whole block", "block", blockNumber, "txs", len(txList))
+		if _, _, err := processBlock(db, bc, blockNumber); err != nil {
+			return replay, err
+		}
+		if txInfo = hookTxInfo(tx.Hash()); txInfo == nil {
+			return replay, fmt.Errorf("no hook data for transaction %s", tx.Hash().Hex())
+		}
+	}
+	replay.CallQueue = txInfo.CallQueue
+	if replay.CallTree == nil { //没有 EVMLogger 的数据时只根据 Hook 构建
+		replay.CallTree = BuildCallTree(txInfo)
+	} else {
+		AttachKeyOpcodes(replay.CallTree, txInfo.CallQueue)
+	}
+	return replay, nil
+}
+
+// Hook 数据中一笔交易的信息，没有时返回 nil，调用者要持有 hookLock
+// 同一笔交易有多条记录时（Hook 的数据没有在交易之间清空）使用最后一条
+func hookTxInfo(txHash common.Hash) *parallel.TxInfo {
+	blockInfo := parallel.GetBlockInfo()
+	if blockInfo == nil {
+		return nil
+	}
+	for i := len(blockInfo.Tx) - 1; i >= 0; i-- {
+		if blockInfo.Tx[i].TxHash == txHash {
+			return blockInfo.Tx[i]
+		}
+	}
+	return nil
+}
+
+// 输出文本格式
+func (r *TxReplay) WriteText(w io.Writer) {
+	fmt.Fprintln(w, "Block Number:", r.BlockNumber)
+	fmt.Fprintln(w, "Tx Index:", r.TxIndex)
+	fmt.Fprintln(w, "Tx Hash:", r.TxHash)
+	fmt.Fprintln(w, "Tx From:", r.From)
+	if r.To != nil {
+		fmt.Fprintln(w, "Tx To:", r.To.Hex())
+	} else {
+		fmt.Fprintln(w, "Tx To: nil (Create", r.NewContract.Hex()+")")
+	}
+	fmt.Fprintln(w, "Tx Value:", r.Value)
+	fmt.Fprintln(w, "Gas Used:", r.GasUsed)
+	fmt.Fprintln(w, "Tx Type:", r.Type)
+	if r.Type == types.BlobTxType {
+		fmt.Fprintln(w, "Blob Hashes:", r.BlobHashes)
+		fmt.Fprintln(w, "Blob Gas Used:", r.BlobGasUsed)
+	}
+	fmt.Fprintln(w, "Status:", r.Status)
+	fmt.Fprintln(w, "Exec Time:", time.Duration(r.ExecTimeNs))
+
+	fmt.Fprintln(w, "\nOpcodes:")
+	for _, stat := range r.Opcodes {
+		fmt.Fprintf(w, "\t%-16s count: %-8d time: %-12s gas: %d\n", stat.Opcode, stat.Count, time.Duration(stat.TimeNs), stat.Gas)
+	}
+
+	fmt.Fprintln(w, "\nOpcode Categories:")
+	writeOpcodeCategoryStats(w, r.Categories)
+
+	fmt.Fprintln(w, "\nPrecompiles:")
+	writePrecompileStats(w, r.Precompiles)
+
+	fmt.Fprintln(w, "\nCall Tree:")
+	if r.CallTree != nil {
+		r.CallTree.WriteText(w)
+	}
+}
+
+// replay-tx 子命令
+func ReplayTxCommand(args []string) {
+	flagSet := flag.NewFlagSet("replay-tx", flag.ExitOnError)
+	outDir := flagSet.String("out", "./output", "output directory")
+	chainFlags(flagSet)
+	logFlags(flagSet)
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: go run . replay-tx [flags] <tx hash | block:index>")
+		fmt.Fprintln(os.Stderr, "CallQueue is read from the hook data of the single transaction; if the hook only records inside Process, the whole block is replayed once more")
+		flagSet.PrintDefaults()
+	}
+	flagSet.Parse(args)
+	if flagSet.NArg() != 1 {
+		flagSet.Usage()
+		os.Exit(2)
+	}
+
+	db, bc, err := openChain()
+	if err != nil {
+		return
+	}
+	defer db.Close()
+
+	blockNumber, index, err := resolveTx(db, flagSet.Arg(0))
+	if err != nil {
+		logger.Error("resolve transaction fail", "err", err)
+		return
+	}
+	replay, err := ReplayTx(db, bc, blockNumber, index)
+	if replay == nil {
+		logger.Error("replay transaction fail", "block", blockNumber, "tx", index, "err", err)
+		return
+	}
+	if err != nil { //交易已经执行，只是没有 Hook 的数据
+		logger.Warn("read hook data fail", "block", blockNumber, "err", err)
+	}
+
+	fileName := fmt.Sprintf("%s/ReplayTx_%d_%d", *outDir, blockNumber, index)
+	jsonData, err := json.MarshalIndent(replay, "", "  ")
+	if err == nil {
+		err = os.WriteFile(fileName+".json", jsonData, 0644)
+	}
+	if err != nil {
+		logger.Error("write json fail", "err", err)
+		return
+	}
+	file, err := os.Create(fileName + ".txt")
+	if err != nil {
+		logger.Error("create file fail", "err", err)
+		return
+	}
+	defer file.Close()
+	replay.WriteText(file)
+	replay.WriteText(os.Stdout)
+	logger.Info("output file", "path", fileName+".json")
+	logger.Info("output file", "path", fileName+".txt")
+	if replay.CallTree != nil {
+		if err := os.WriteFile(fileName+".calltree.gv", []byte(replay.CallTree.toDOT(fmt.Sprintf("tx%d", index))), 0644); err != nil {
+			logger.Error("write call tree fail", "err", err)
+			return
+		}
+		logger.Info("output file", "path", fileName+".calltree.gv")
+	}
+}
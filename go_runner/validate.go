@@ -0,0 +1,67 @@
+package main
+
+//--------------------------------------------------------------------------------------
+//本文件在区块执行之后检查执行结果是否与区块头一致（相当于 BlockValidator.ValidateState），确认插桩的 geth 没有改变执行结果
+//检查 gas used、blob gas used、receipt root、bloom 和执行后的 state root，并列出所有不一致的字段
+//子命令加上 -validate 参数即可开启，不一致的区块会被当作执行失败（原因为 validation_failed）
+//--------------------------------------------------------------------------------------
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// 为 true 时每个区块执行之后都检查执行结果
+var validateReplay bool = false
+
+// 执行结果与区块头不一致
+var errValidation = errors.New("block validation fail")
+
+// 给子命令添加 -validate 参数
+func validateFlags(flagSet *flag.FlagSet) {
+	flagSet.BoolVar(&validateReplay, "validate", validateReplay, "check gas used, receipt root, bloom and state root against the block header")
+}
+
+// 检查执行结果，返回所有不一致的字段，全部一致时返回 nil
+func validateExecution(config *params.ChainConfig, block *types.Block, stateDb *state.StateDB, receipts types.Receipts, usedGas uint64) error {
+	header := block.Header()
+	mismatchList := []string{}
+	if usedGas != header.GasUsed {
+		mismatchList = append(mismatchList, fmt.Sprintf("gas used (remote: %d local: %d)", header.GasUsed, usedGas))
+	}
+	if header.BlobGasUsed != nil { //Cancun 之后的区块
+		if blobGas := receiptsBlobGas(receipts); blobGas != *header.BlobGasUsed {
+			mismatchList = append(mismatchList, fmt.Sprintf("blob gas used (remote: %d local: %d)", *header.BlobGasUsed, blobGas))
+		}
+	}
+	if bloom := types.CreateBloom(receipts); bloom != header.Bloom {
+		mismatchList = append(mismatchList, "bloom")
+	}
+	if receiptSha := types.DeriveSha(receipts, trie.NewStackTrie(nil)); receiptSha != header.ReceiptHash {
+		mismatchList = append(mismatchList, fmt.Sprintf("receipt root (remote: %x local: %x)", header.ReceiptHash, receiptSha))
+	}
+	if root := stateDb.IntermediateRoot(config.IsEIP158(header.Number)); root != header.Root {
+		mismatchList = append(mismatchList, fmt.Sprintf("state root (remote: %x local: %x)", header.Root, root))
+	}
+	if len(mismatchList) > 0 {
+		return fmt.Errorf("%w: %s", errValidation, strings.Join(mismatchList, ", "))
+	}
+	return nil
+}
+
+// 执行得到的收据中 blob gas used 之和，应该等于区块头的 blob gas used
+// 只有 blob 交易（type 3）的收据有 blob gas used，其他交易为 0
+func receiptsBlobGas(receipts types.Receipts) uint64 {
+	var blobGas uint64 = 0
+	for _, receipt := range receipts {
+		blobGas += receipt.BlobGasUsed
+	}
+	return blobGas
+}
@@ -3,7 +3,7 @@ use reth_db::{open_db_read_only, mdbx::DatabaseArguments, models::client_version
 use reth_provider::{BlockReaderIdExt, StateProviderFactory, BlockExecutor, ProviderFactory, providers::BlockchainProvider, TransactionVariant};
 
 use reth_primitives::{
-    MAINNET, BlockId, U256
+    MAINNET, BlockId, U256, proofs::calculate_receipt_root
 };
 
 use reth_revm::{
@@ -25,12 +25,37 @@ use std::path::Path;
 use std::sync::Arc;
 use chrono::Local;
 
-use std::time::Duration;
+use std::time::{Duration, Instant};
 use std::fs::File;
-use csv::{Reader, Error};
+use csv::{ReaderBuilder, Writer, Error};
 
 // #[derive(Parser, Debug)]
 
+// Read block numbers from the first column of a block list file.
+// Same rules as go_runner/block_list.go ReadBlockList: blank lines are skipped,
+// the first line is a header only if it is not a block number, any other non-numeric line is an error.
+fn read_block_list(path: &str) -> Result<Vec<u64>, Error> {
+    let file = File::open(path)?;
+    let mut reader = ReaderBuilder::new().has_headers(false).flexible(true).from_reader(file);
+    let mut block_list = Vec::new();
+    for (line, result) in reader.records().enumerate() {
+        let record = result?;
+        let first = record.get(0).unwrap_or("").trim();
+        if first.is_empty() {
+            continue;
+        }
+        match first.parse::<u64>() {
+            Ok(num) => block_list.push(num),
+            Err(_) if line == 0 => continue, // header
+            Err(err) => {
+                let msg = format!("{} line {}: invalid block number {:?}: {}", path, line + 1, first, err);
+                return Err(Error::from(std::io::Error::new(std::io::ErrorKind::InvalidData, msg)));
+            }
+        }
+    }
+    Ok(block_list)
+}
+
 
 fn main() -> Result<(), Error> {
     // Read Database Info
@@ -70,12 +95,16 @@ fn main() -> Result<(), Error> {
     let mut round_num = 0;
     // let gas_used_sum = 0;
     // let mut exec_time_sum = Duration::new(0, 0);
-    let file = File::open("../block_range.csv")?;
-    let mut reader = Reader::from_reader(file);
+    let block_list = read_block_list("../block_range.csv")?;
 
-    for result in reader.records() {
-        let record = result?;
-        let new_block_num = record[0].parse::<u64>().unwrap();
+    // Per-block results, same schema as go_runner/block_result.go
+    // receipts_root is computed from the execution receipts
+    // state_root is left empty: the historical state provider (history_by_block_number) cannot compute state roots,
+    // go_runner compare reports it as not compared
+    let mut writer = Writer::from_path("rust_result.csv")?;
+    writer.write_record(&["block_number", "gas_used", "tx_count", "exec_time_ns", "state_root", "receipts_root"])?;
+
+    for new_block_num in block_list {
         println!("Run block num: {:?}", new_block_num);
 
         let old_block_num = new_block_num - 1;
@@ -87,7 +116,12 @@ fn main() -> Result<(), Error> {
 
         // let result = executor.execute_and_verify_receipt(&new_block, U256::ZERO, None).unwrap();
 
-        executor.execute_transactions(&new_block, U256::ZERO).unwrap();
+        let exec_start = Instant::now();
+        let (receipts, gas_used) = executor.execute_transactions(&new_block, U256::ZERO).unwrap();
+        let exec_time = exec_start.elapsed();
+
+        let receipts_with_bloom: Vec<_> = receipts.into_iter().map(|receipt| receipt.with_bloom()).collect();
+        let receipts_root = calculate_receipt_root(&receipts_with_bloom);
 
         // let stat = executor.stats();
         let result = executor.take_output_state();
@@ -97,6 +131,16 @@ fn main() -> Result<(), Error> {
 
         // let exec_time = stat.execution_duration;
 
+        writer.write_record(&[
+            new_block_num.to_string(),
+            gas_used.to_string(),
+            new_block.body.len().to_string(),
+            exec_time.as_nanos().to_string(),
+            String::new(),
+            format!("{:?}", receipts_root),
+        ])?;
+        writer.flush()?;
+
         round_num += 1;
         // gas_used_sum += gas_used;
         // exec_time_sum += exec_time;